@@ -0,0 +1,233 @@
+package synacor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Operations by name, for the assembler.
+var opcodeByName = func() map[string]opcode {
+	m := make(map[string]opcode)
+	for oc, properties := range operatorPropertyMap {
+		m[properties.name] = oc
+	}
+	return m
+}()
+
+// statement is an instruction (or data) from a line of assembly, with its
+// operands still to be resolved.
+type statement struct {
+	line     int
+	name     string
+	operands []string
+}
+
+// Assemble turns assembly into a program that starts at address origin.  It
+// reads what Instruction.Format writes: one instruction per line (or several
+// separated by ';'), operands separated by spaces or commas, '#' starting a
+// comment.  Operands are registers (r0 to r7), numbers, characters ('a',
+// '\n'), labels defined with "name:" or names from symbols (which can be nil),
+// optionally with an offset (name+3).  "data" writes its operands as words.
+func Assemble(src string, origin uint16, symbols *Symbols) ([]uint16, error) {
+	program, _, err := AssembleSource(src, origin, symbols)
+	return program, err
+}
+
+// AssembleSource assembles like Assemble and also returns which line of src
+// each address came from.
+func AssembleSource(src string, origin uint16, symbols *Symbols) ([]uint16, SourceMap, error) {
+	statements := []statement{}
+	lines := SourceMap{}
+	labels := make(map[string]int)
+	address := int(origin)
+
+	for n, line := range strings.Split(src, "\n") {
+		for _, text := range splitStatements(line) {
+			fields, err := tokenize(text)
+			if err != nil {
+				return nil, lines, fmt.Errorf("line %d: %v", n+1, err)
+			}
+
+			// labels
+			for len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+				name := strings.TrimSuffix(fields[0], ":")
+				if _, ok := labels[name]; ok {
+					return nil, lines, fmt.Errorf("line %d: label %q defined twice", n+1, name)
+				}
+				labels[name] = address
+				fields = fields[1:]
+			}
+			if len(fields) == 0 {
+				continue
+			}
+
+			s := statement{n + 1, strings.ToLower(fields[0]), fields[1:]}
+			size, err := s.size()
+			if err != nil {
+				return nil, lines, err
+			}
+			statements = append(statements, s)
+			if size > 0 {
+				lines.add(uint16(address), n+1)
+			}
+			address += size
+		}
+	}
+
+	if address > maxMemory+1 {
+		return nil, lines, fmt.Errorf("program is %d words, more than fits in memory", address-int(origin))
+	}
+
+	program := []uint16{}
+	for _, s := range statements {
+		words, err := s.assemble(labels, symbols)
+		if err != nil {
+			return nil, lines, err
+		}
+		program = append(program, words...)
+	}
+	return program, lines, nil
+}
+
+func (s statement) size() (int, error) {
+	if s.name == "data" {
+		return len(s.operands), nil
+	}
+
+	oc, ok := opcodeByName[s.name]
+	if !ok {
+		return 0, fmt.Errorf("line %d: unknown operation %q", s.line, s.name)
+	}
+	if args := operatorPropertyMap[oc].args; args != len(s.operands) {
+		return 0, fmt.Errorf("line %d: %s takes %d operands, got %d", s.line, s.name, args, len(s.operands))
+	}
+	return 1 + len(s.operands), nil
+}
+
+func (s statement) assemble(labels map[string]int, symbols *Symbols) ([]uint16, error) {
+	words := []uint16{}
+	if s.name != "data" {
+		words = append(words, uint16(opcodeByName[s.name]))
+	}
+
+	for _, operand := range s.operands {
+		// data can be any word, even ones that aren't valid operands
+		if n, err := strconv.ParseUint(operand, 10, 16); err == nil && s.name == "data" {
+			words = append(words, uint16(n))
+			continue
+		}
+
+		v, err := resolve(operand, labels, symbols)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", s.line, err)
+		}
+		words = append(words, v)
+	}
+	return words, nil
+}
+
+// resolve turns an operand into its value.
+func resolve(operand string, labels map[string]int, symbols *Symbols) (uint16, error) {
+	if len(operand) == 2 && (operand[0] == 'r' || operand[0] == 'R') && operand[1] >= '0' && operand[1] <= '7' {
+		return uint16(registerStart + int(operand[1]-'0')), nil
+	}
+
+	if strings.HasPrefix(operand, "'") {
+		c, err := strconv.Unquote(operand)
+		if err != nil || len([]rune(c)) != 1 {
+			return 0, fmt.Errorf("bad character %s", operand)
+		}
+		return uint16([]rune(c)[0]), nil
+	}
+
+	if n, err := strconv.ParseUint(operand, 10, 16); err == nil {
+		if n > registerEnd {
+			return 0, fmt.Errorf("%d is too big", n)
+		}
+		return uint16(n), nil
+	}
+
+	name, offset := operand, 0
+	if i := strings.LastIndex(operand, "+"); i > 0 {
+		n, err := strconv.Atoi(operand[i+1:])
+		if err != nil {
+			return 0, fmt.Errorf("bad offset in %q", operand)
+		}
+		name, offset = operand[:i], n
+	}
+
+	address, ok := labels[name]
+	if !ok {
+		sym, found := symbols.byName(name)
+		if !found {
+			return 0, fmt.Errorf("unknown name %q", name)
+		}
+		address = int(sym.Address)
+	}
+
+	if address+offset > maxMemory {
+		return 0, fmt.Errorf("%s is past the end of memory", operand)
+	}
+	return uint16(address + offset), nil
+}
+
+// splitStatements splits a line on ';', leaving out comments and ';' or '#' in
+// character literals.
+func splitStatements(line string) []string {
+	statements := []string{}
+	start, quoted := 0, false
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '\'':
+			quoted = !quoted
+		case !quoted && c == ';':
+			statements = append(statements, line[start:i])
+			start = i + 1
+		case !quoted && c == '#':
+			return append(statements, line[start:i])
+		}
+	}
+	return append(statements, line[start:])
+}
+
+// tokenize splits a statement into fields on spaces and commas, keeping
+// character literals whole.
+func tokenize(s string) ([]string, error) {
+	fields := []string{}
+	var field strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'':
+			end := i + 1
+			for end < len(s) && s[end] != '\'' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated character in %q", strings.TrimSpace(s))
+			}
+			field.WriteString(s[i : end+1])
+			i = end
+		case c == ' ' || c == '\t' || c == ',' || c == '\r':
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteByte(c)
+		}
+	}
+
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
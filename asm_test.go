@@ -0,0 +1,84 @@
+package synacor
+
+import "testing"
+
+func TestAssemble(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 6027, Type: Function, Name: "confirm_teleporter"})
+
+	src := `# comments and blank lines are skipped
+
+start:	set r7, 25734
+	call confirm_teleporter
+	out ';'; out '\n'   # two on one line
+loop: jt r0 loop+1
+	jmp start
+	data 1 65535 'a'
+`
+	expected := []uint16{
+		uint16(opSet), register7, 25734,
+		uint16(opCall), 6027,
+		uint16(opOut), ';', uint16(opOut), '\n',
+		uint16(opJt), register0, 110,
+		uint16(opJmp), 100,
+		1, 65535, 'a',
+	}
+
+	result, err := Assemble(src, 100, s)
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if len(result) != len(expected) {
+		t.Fatal("Got:", result, "Expected:", expected)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Error("Got:", result[i], "Expected:", expected[i], "At:", i)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []string{
+		"jump 5",
+		"set r0",
+		"out 'ab'",
+		"out 'a",
+		"jmp nowhere",
+		"set r0 40000",
+		"a: noop\na: noop",
+		"jmp end+x",
+	}
+
+	for _, test := range tests {
+		if _, err := Assemble(test, 0, nil); err == nil {
+			t.Error("Expected an error for:", test)
+		}
+	}
+}
+
+// Valid instructions and data the disassembler writes assemble back into the
+// same words.
+func TestAssembleDisassembly(t *testing.T) {
+	memory := []uint16{
+		uint16(opSet), register7, 25734,
+		uint16(opOut), '\'',
+		uint16(opOut), 7,
+		uint16(opWmem), register1, 32767,
+		300, 40000,
+	}
+
+	for _, i := range Disassemble(memory) {
+		result, err := Assemble(i.String(), i.Address, nil)
+		if err != nil {
+			t.Error("Got:", err, "Expected:", nil, "For:", i)
+			continue
+		}
+		for n, word := range result {
+			if word != memory[int(i.Address)+n] {
+				t.Error("Got:", result, "Expected:", memory[i.Address:int(i.Address)+i.Size()])
+				break
+			}
+		}
+	}
+}
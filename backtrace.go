@@ -0,0 +1,123 @@
+package synacor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Calls named in the trace and in faults; deep recursion would bury the rest.
+const chainLength = 5
+
+// Frame is a call the program hasn't returned from.
+type Frame struct {
+	// Call is the address of the call instruction, Function where it went
+	Call     uint16 `json:"call"`
+	Function uint16 `json:"function"`
+	// Return is the address the call pushed and Depth how deep the stack was
+	// once it had
+	Return uint16 `json:"return"`
+	Depth  int    `json:"depth"`
+	// Tampered is true if the return address isn't where the call pushed it
+	// any more: it's been popped, or popped and something else pushed
+	Tampered bool `json:"tampered,omitempty"`
+}
+
+// Backtrace is the calls the program is in, innermost first.
+type Backtrace []Frame
+
+// Format writes a call per line, naming addresses with symbols (which can be
+// nil).
+func (b Backtrace) Format(symbols *Symbols) string {
+	var s strings.Builder
+	for _, f := range b {
+		fmt.Fprintf(&s, "%s called from %s", symbols.Name(f.Function), symbols.Name(f.Call))
+		if f.Tampered {
+			fmt.Fprintf(&s, " (return address %d is gone from the stack)", f.Return)
+		}
+		s.WriteString("\n")
+	}
+	return s.String()
+}
+
+// chain names the innermost functions, innermost first, out of total calls.
+func (b Backtrace) chain(symbols *Symbols, total int) string {
+	names := []string{}
+	for _, f := range b {
+		if len(names) == chainLength {
+			break
+		}
+		names = append(names, symbols.Name(f.Function))
+	}
+	if total > len(names) {
+		names = append(names, fmt.Sprintf("%d more", total-len(names)))
+	}
+	return strings.Join(names, " < ")
+}
+
+// Backtrace returns the calls the program is in, innermost first.  The
+// Machine keeps its own record of calls alongside the stack, so values pushed
+// on the stack aren't mistaken for return addresses.  The record starts empty
+// when a program's loaded, even a snapshot taken mid-call.
+func (m Machine) Backtrace() Backtrace {
+	return m.Program.backtrace(m.Stack)
+}
+
+func (p *program) backtrace(s *stack) Backtrace {
+	b := make(Backtrace, len(p.calls))
+	for i, f := range p.calls {
+		f.Tampered = f.Depth > len(*s) || (*s)[f.Depth-1] != f.Return
+		b[len(p.calls)-1-i] = f
+	}
+	return b
+}
+
+// called records a call that's just pushed its return address.
+func (p *program) called(function uint16, s *stack) {
+	p.calls = append(p.calls, Frame{
+		Call:     uint16(p.start),
+		Function: function,
+		Return:   (*s)[len(*s)-1],
+		Depth:    len(*s),
+	})
+}
+
+// returned takes the call being returned from off the record, given the
+// address popped and how deep the stack was before popping it.  A ret that
+// doesn't match the innermost call means the program's been at the stack:
+// calls whose return addresses were popped are dropped, and the trace notes
+// it.
+func (p *program) returned(address uint16, depth int) {
+	for i := len(p.calls) - 1; i >= 0; i-- {
+		f := p.calls[i]
+		if f.Depth > depth {
+			continue
+		}
+		if f.Depth < depth {
+			break
+		}
+
+		if dropped := len(p.calls) - 1 - i; dropped > 0 {
+			p.tracef(" (tampered: %d calls' return addresses were popped)", dropped)
+		}
+		if f.Return != address {
+			p.tracef(" (tampered: the return address was %v)", p.label(f.Return))
+		}
+		p.calls = p.calls[:i]
+		return
+	}
+	p.tracef(" (tampered: no call pushed %v)", p.label(address))
+}
+
+// callChain prints as the innermost functions being called, for the trace.
+type callChain struct {
+	p *program
+}
+
+func (c callChain) String() string {
+	calls := c.p.calls
+	b := Backtrace{}
+	for i := len(calls) - 1; i >= 0 && len(b) < chainLength; i-- {
+		b = append(b, calls[i])
+	}
+	return b.chain(c.p.symbols, len(calls))
+}
@@ -0,0 +1,157 @@
+package synacor
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assembled returns a test machine running src, failing the test if it
+// doesn't assemble.
+func assembled(t *testing.T, src string) Machine {
+	program, err := Assemble(src, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestMachine(program)
+}
+
+// runTo steps m until it gets to an address.
+func runTo(t *testing.T, m Machine, address int) {
+	for n := 0; m.PC() != address; n++ {
+		if n == 100 || m.Stopped() != NotStopped {
+			t.Fatal("Got:", m.PC(), m.Stopped(), "Expected to get to:", address)
+		}
+		m.Step()
+	}
+}
+
+func TestMachineBacktrace(t *testing.T) {
+	// f pushes data before calling g, so the stack is 2, 9, 7 in g
+	m := assembled(t, `
+		call f          # 0
+		halt            # 2
+		f: push 9; call g; pop r0; ret
+		g: ret          # 10`)
+	runTo(t, m, 10)
+
+	expected := Backtrace{
+		{Call: 5, Function: 10, Return: 7, Depth: 3},
+		{Call: 0, Function: 3, Return: 2, Depth: 1},
+	}
+	if b := m.Backtrace(); !reflect.DeepEqual(b, expected) {
+		t.Error("Got:", b, "Expected:", expected)
+	}
+
+	// returning pops the calls
+	runTo(t, m, 2)
+	if b := m.Backtrace(); len(b) != 0 {
+		t.Error("Got:", b, "Expected:", Backtrace{})
+	}
+}
+
+func TestMachineBacktraceTampering(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// where to look at the backtrace, and what it should be
+		at       int
+		expected Backtrace
+		// what the trace should say when the ret runs, and how many calls
+		// are left after it
+		trace string
+		calls int
+	}{
+		{
+			"return address replaced",
+			"call f; halt; f: pop r0; push 100; ret",
+			7, Backtrace{{Call: 0, Function: 3, Return: 2, Depth: 1, Tampered: true}},
+			"tampered: the return address was 2", 0,
+		},
+		{
+			"return address popped",
+			"call f; halt; f: call g; halt; g: pop r0; ret",
+			8, Backtrace{{Call: 3, Function: 6, Return: 5, Depth: 2, Tampered: true}, {Call: 0, Function: 3, Return: 2, Depth: 1}},
+			"tampered: 1 calls' return addresses were popped", 0,
+		},
+		{
+			"jump through a pushed address",
+			"call f; halt; f: push 2; ret",
+			5, Backtrace{{Call: 0, Function: 3, Return: 2, Depth: 1}},
+			"tampered: no call pushed 2", 1,
+		},
+	}
+
+	for _, test := range tests {
+		m := assembled(t, test.src)
+		runTo(t, m, test.at)
+		if b := m.Backtrace(); !reflect.DeepEqual(b, test.expected) {
+			t.Error("Got:", b, "Expected:", test.expected, "For:", test.name)
+		}
+
+		var trace bytes.Buffer
+		m.SetTrace(&trace)
+		m.Step()
+		if !strings.Contains(trace.String(), test.trace) {
+			t.Error("Got:", trace.String(), "Expected:", test.trace, "For:", test.name)
+		}
+		if len(m.Backtrace()) != test.calls {
+			t.Error("Got:", m.Backtrace(), "Expected calls:", test.calls, "For:", test.name)
+		}
+	}
+}
+
+func TestBacktraceFormat(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 0, Type: Function, Name: "main"})
+	s.Add(Symbol{Address: 100, Type: Function, Name: "f"})
+
+	b := Backtrace{
+		{Call: 104, Function: 100, Return: 106, Depth: 2, Tampered: true},
+		{Call: 3, Function: 100, Return: 5, Depth: 1},
+	}
+	expected := "f called from f+4 (return address 106 is gone from the stack)\nf called from main+3\n"
+	if result := b.Format(s); result != expected {
+		t.Errorf("Got: %q Expected: %q", result, expected)
+	}
+}
+
+func TestMachineBacktraceInFaults(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 2, Type: Function, Name: "f"})
+
+	m := assembled(t, "call f; f: call f")
+	m.SetSymbols(s)
+	m.SetStackLimit(7)
+	var trace bytes.Buffer
+	m.SetTrace(&trace)
+
+	m.RunSteps(100)
+	f := m.Fault()
+	if f == nil {
+		t.Fatal("Got:", f, "Expected: a fault")
+	}
+
+	expected := "fault at 2 (call 2): stack overflow, more than 7 deep in f < f < f < f < f < 2 more"
+	if f.Error() != expected {
+		t.Error("Got:", f.Error(), "Expected:", expected)
+	}
+	if len(f.Backtrace) != 7 {
+		t.Error("Got:", len(f.Backtrace), "Expected:", 7)
+	}
+	if !strings.Contains(trace.String(), "Calls: f < f < f") || !strings.HasSuffix(trace.String(), expected+"\n") {
+		t.Error("Got:", trace.String(), "Expected the calls and the fault")
+	}
+}
+
+func TestMachineCloneBacktrace(t *testing.T) {
+	m := assembled(t, "call f; halt; f: ret")
+	m.Step()
+
+	c := m.Clone()
+	c.Step()
+	if len(c.Backtrace()) != 0 || len(m.Backtrace()) != 1 {
+		t.Error("Got:", c.Backtrace(), m.Backtrace(), "Expected the clone to return on its own")
+	}
+}
@@ -0,0 +1,116 @@
+package synacor
+
+// Block is a basic block of the program translated to Go, by cmd/syn2go.  Run
+// executes its instructions and returns the address to carry on from and how
+// many instructions it executed.  It returns early, at an instruction it
+// can't run the way the interpreter would (one that would fault or wait for
+// input, say), for the interpreter to run.
+type Block struct {
+	// Code is the words the block was translated from; while memory doesn't
+	// hold them the interpreter runs the program there instead
+	Code []uint16
+	Run  func(r *Runtime) (next uint16, steps int)
+}
+
+// Runtime is what a Block runs on: the registers and the memory and stack of
+// a Machine, changed the way its instructions would change them.
+type Runtime struct {
+	m Machine
+	// R is the registers, which always hold numbers (0 to 32767)
+	R *[8]uint16
+}
+
+// RunBlocks runs the loaded program like RunSteps with no limit, running
+// blocks at the addresses they start at and the interpreter everywhere else.
+// Blocks aren't traced.
+func (m Machine) RunBlocks(blocks map[uint16]Block) StopReason {
+	r := &Runtime{m, (*[8]uint16)(m.Registers)}
+	p := m.Program
+	for p.stop == NotStopped {
+		if b, ok := blocks[uint16(p.index)]; ok && p.index < len(p.memory) && r.holds(b.Code) {
+			next, steps := b.Run(r)
+			p.steps += uint64(steps)
+			p.index = int(next)
+			if steps > 0 {
+				continue
+			}
+		}
+
+		m.Step()
+	}
+	return p.stop
+}
+
+// holds returns true if memory at the index holds code.
+func (r *Runtime) holds(code []uint16) bool {
+	p := r.m.Program
+	if p.index+len(code) > len(p.memory) {
+		return false
+	}
+	for i, word := range code {
+		if p.memory[p.index+i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// Read returns the word at an address, like rmem.
+func (r *Runtime) Read(address uint16) uint16 {
+	return r.m.Program.read(address)
+}
+
+// Write sets the word at an address, like wmem.
+func (r *Runtime) Write(address, value uint16) {
+	r.m.Program.write(address, value)
+}
+
+// Push pushes a value, returning false without pushing it if the stack is as
+// deep as its limit.
+func (r *Runtime) Push(value uint16) bool {
+	if r.full() {
+		return false
+	}
+	r.m.Stack.push(value)
+	return true
+}
+
+// Pop pops a value to put in a register, returning false without popping it
+// if the stack is empty or the value isn't a number.
+func (r *Runtime) Pop() (uint16, bool) {
+	s := *r.m.Stack
+	if len(s) == 0 || !isLiteralValue(s[len(s)-1]) {
+		return 0, false
+	}
+	return r.m.Stack.pop(), true
+}
+
+// Call calls a function from the call at an address, returning false without
+// calling it if the stack is as deep as its limit or the function is hooked.
+func (r *Runtime) Call(address, function uint16) bool {
+	p := r.m.Program
+	if _, hooked := p.hooks[function]; hooked || r.full() {
+		return false
+	}
+	p.start = int(address)
+	r.m.Stack.push(address + 2)
+	p.called(function, r.m.Stack)
+	return true
+}
+
+// Ret pops the address to return to, returning false if the stack is empty.
+func (r *Runtime) Ret() (uint16, bool) {
+	s := r.m.Stack
+	if s.isEmpty() {
+		return 0, false
+	}
+	depth := len(*s)
+	a := s.pop()
+	r.m.Program.returned(a, depth)
+	return a, true
+}
+
+func (r *Runtime) full() bool {
+	limit := r.m.Program.stackLimit
+	return limit > 0 && len(*r.m.Stack) >= limit
+}
@@ -0,0 +1,102 @@
+package synacor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMachineRunBlocks(t *testing.T) {
+	m := assembled(t, "call f; halt; f: push 7; pop r0; ret")
+	ran := []uint16{}
+	blocks := map[uint16]Block{
+		0: {Code: []uint16{uint16(opCall), 3}, Run: func(r *Runtime) (uint16, int) {
+			ran = append(ran, 0)
+			if !r.Call(0, 3) {
+				return 0, 0
+			}
+			return 3, 1
+		}},
+		3: {Code: []uint16{uint16(opPush), 7, uint16(opPop), register0, uint16(opRet)}, Run: func(r *Runtime) (uint16, int) {
+			ran = append(ran, 3)
+			if !r.Push(7) {
+				return 3, 0
+			}
+			v, ok := r.Pop()
+			if !ok {
+				return 5, 1
+			}
+			r.R[0] = v
+			if a, ok := r.Ret(); ok {
+				return a, 3
+			}
+			return 7, 2
+		}},
+	}
+
+	if stop := m.RunBlocks(blocks); stop != Halted {
+		t.Fatal("Got:", stop, "Expected:", Halted)
+	}
+	if !reflect.DeepEqual(ran, []uint16{0, 3}) || m.Register(0) != 7 || m.Steps() != 5 || len(m.Backtrace()) != 0 {
+		t.Error("Got:", ran, m.Register(0), m.Steps(), m.Backtrace(), "Expected: both blocks, r0 7 and 5 steps")
+	}
+}
+
+func TestMachineRunBlocksFallsBack(t *testing.T) {
+	tests := []struct {
+		name string
+		// set up the Machine before it runs
+		setup func(m Machine)
+		// whether the block runs
+		ran bool
+	}{
+		{"code unchanged", func(m Machine) {}, true},
+		{"code changed", func(m Machine) { m.SetMemory(1, 8) }, false},
+		{"stack full", func(m Machine) { m.SetStackLimit(1); m.SetStack([]uint16{1}) }, false},
+		{"hooked", func(m Machine) { m.SetHook(3, func(Machine) error { return nil }) }, false},
+	}
+
+	for _, test := range tests {
+		m := assembled(t, "call 3; halt; ret")
+		test.setup(m)
+		ran := false
+		blocks := map[uint16]Block{
+			0: {Code: []uint16{uint16(opCall), 3}, Run: func(r *Runtime) (uint16, int) {
+				if !r.Call(0, 3) {
+					return 0, 0
+				}
+				ran = true
+				return 3, 1
+			}},
+		}
+
+		// the interpreter runs what the block doesn't, so the result's the same
+		i := assembled(t, "call 3; halt; ret")
+		test.setup(i)
+		i.RunSteps(0)
+		m.RunBlocks(blocks)
+
+		if ran != test.ran || m.Stopped() != i.Stopped() || m.PC() != i.PC() || m.Steps() != i.Steps() {
+			t.Error("Got:", ran, m.Stopped(), m.PC(), m.Steps(), "Expected:", test.ran, i.Stopped(), i.PC(), i.Steps(), "For:", test.name)
+		}
+	}
+}
+
+func TestRuntimePop(t *testing.T) {
+	m := newTestMachine([]uint16{uint16(opHalt)})
+	r := &Runtime{m, (*[8]uint16)(m.Registers)}
+
+	if _, ok := r.Pop(); ok {
+		t.Error("Got:", ok, "Expected: no pop from an empty stack")
+	}
+	// a value that isn't a number faults when it's popped into a register
+	m.SetStack([]uint16{32768})
+	if _, ok := r.Pop(); ok || len(*m.Stack) != 1 {
+		t.Error("Got:", ok, *m.Stack, "Expected: the stack left alone")
+	}
+	if _, ok := r.Ret(); !ok || len(*m.Stack) != 0 {
+		t.Error("Got:", ok, *m.Stack, "Expected: to return")
+	}
+	if _, ok := r.Ret(); ok {
+		t.Error("Got:", ok, "Expected: no return with an empty stack")
+	}
+}
@@ -0,0 +1,239 @@
+package synacor
+
+import "fmt"
+
+// maxBlockOps is the most instructions a cached block holds.
+const maxBlockOps = 64
+
+// microOp is an instruction decoded once for the block cache: its operation,
+// its raw arguments and where it and the next instruction are.
+type microOp struct {
+	op      opcode
+	a, b, c uint16
+	at      uint16
+	next    uint16
+}
+
+// cachedBlock is instructions that run one after another from start, decoded
+// for RunCached.  A block with no ops marks an address that starts with an
+// instruction the interpreter has to run.
+type cachedBlock struct {
+	start, end uint16
+	ops        []microOp
+}
+
+// blockCache holds the blocks decoded from a program's memory, by the address
+// they start at, and how many blocks cover each address so writes to memory
+// outside any block cost next to nothing.
+type blockCache struct {
+	blocks  []*cachedBlock
+	covered []uint16
+}
+
+func newBlockCache() *blockCache {
+	return &blockCache{blocks: make([]*cachedBlock, modulo), covered: make([]uint16, modulo)}
+}
+
+// RunCached runs the loaded program like RunSteps, decoding instructions into
+// blocks once and running those instead of decoding every instruction.  Blocks
+// are thrown away when memory they were decoded from is written to.
+// Instructions that halt, read input, call hooked functions or would fault are
+// left to the interpreter, so the program runs exactly as it would under
+// RunSteps.  Blocks aren't traced, but they do write checkpoints.
+func (m Machine) RunCached(limit uint64) StopReason {
+	p := m.Program
+	if p.cache == nil {
+		p.cache = newBlockCache()
+	}
+
+	for n := uint64(0); p.stop == NotStopped; {
+		if limit > 0 && n >= limit {
+			return StepLimit
+		}
+		if p.index >= len(p.memory) || p.index >= modulo {
+			m.Step()
+			n++
+			continue
+		}
+
+		budget := uint64(0)
+		if limit > 0 {
+			budget = limit - n
+		}
+		ran, bailed := p.cache.block(p).run(p, m.Registers, m.Stack, budget)
+		n += ran
+		if p.stop == NotStopped && p.index >= len(p.memory) {
+			p.stop = EndOfProgram
+		}
+
+		if bailed && (limit == 0 || n < limit) {
+			m.Step()
+			n++
+		}
+	}
+	return p.stop
+}
+
+// block returns the block starting at the program's index, decoding it if it
+// isn't cached.
+func (c *blockCache) block(p *program) *cachedBlock {
+	start := uint16(p.index)
+	if b := c.blocks[start]; b != nil {
+		return b
+	}
+
+	b := &cachedBlock{start: start, end: start + 1}
+	for a := int(start); a < len(p.memory) && len(b.ops) < maxBlockOps; {
+		i := Decode(p.memory, uint16(a))
+		if !i.Compilable() {
+			if len(b.ops) == 0 {
+				b.end = uint16(a + i.Size())
+			}
+			break
+		}
+
+		op := microOp{op: opcode(i.Opcode), at: i.Address, next: i.Address + uint16(i.Size())}
+		args := append(i.Args, 0, 0, 0)
+		op.a, op.b, op.c = args[0], args[1], args[2]
+		b.ops = append(b.ops, op)
+		b.end = op.next
+		a = int(op.next)
+
+		if i.EndsBlock() {
+			break
+		}
+	}
+
+	c.blocks[start] = b
+	for a := int(b.start); a < int(b.end) && a < len(c.covered); a++ {
+		c.covered[a]++
+	}
+	return b
+}
+
+// invalidate throws away the blocks decoded from an address.
+func (c *blockCache) invalidate(address uint16) {
+	if int(address) >= len(c.covered) || c.covered[address] == 0 {
+		return
+	}
+
+	// blocks are at most maxBlockOps instructions of at most 4 words
+	from := 0
+	if int(address) > maxBlockOps*4 {
+		from = int(address) - maxBlockOps*4
+	}
+	for start := from; start <= int(address); start++ {
+		b := c.blocks[start]
+		if b == nil || address >= b.end {
+			continue
+		}
+		c.blocks[start] = nil
+		for a := int(b.start); a < int(b.end) && a < len(c.covered); a++ {
+			c.covered[a]--
+		}
+	}
+}
+
+// value returns a raw argument's value: the register's if it's a register.
+func value(r *registers, a uint16) uint16 {
+	if a >= registerStart {
+		return r[a-registerStart]
+	}
+	return a
+}
+
+// run runs the block's ops, at most budget of them (0 is no limit), and returns
+// how many it ran.  It returns bailed true, with the index at the op, if the
+// next op has to be run by the interpreter.
+func (b *cachedBlock) run(p *program, r *registers, s *stack, budget uint64) (ran uint64, bailed bool) {
+	if len(b.ops) == 0 {
+		return 0, true
+	}
+
+	for k := range b.ops {
+		if budget > 0 && ran == budget {
+			return ran, false
+		}
+		op := &b.ops[k]
+		p.index = int(op.next)
+
+		switch op.op {
+		case opSet:
+			r[op.a-registerStart] = value(r, op.b)
+		case opPush:
+			if p.stackLimit > 0 && len(*s) >= p.stackLimit {
+				p.index = int(op.at)
+				return ran, true
+			}
+			s.push(value(r, op.a))
+		case opPop:
+			if len(*s) == 0 || !isLiteralValue((*s)[len(*s)-1]) {
+				p.index = int(op.at)
+				return ran, true
+			}
+			r[op.a-registerStart] = s.pop()
+		case opEq:
+			r[op.a-registerStart] = uint16(truth(value(r, op.b) == value(r, op.c)))
+		case opGt:
+			r[op.a-registerStart] = uint16(truth(value(r, op.b) > value(r, op.c)))
+		case opJmp:
+			p.index = int(value(r, op.a))
+		case opJt:
+			if value(r, op.a) != 0 {
+				p.index = int(value(r, op.b))
+			}
+		case opJf:
+			if value(r, op.a) == 0 {
+				p.index = int(value(r, op.b))
+			}
+		case opMod:
+			if value(r, op.c) == 0 {
+				p.index = int(op.at)
+				return ran, true
+			}
+			r[op.a-registerStart] = arithmetic(op.op, value(r, op.b), value(r, op.c))
+		case opAdd, opMult, opAnd, opOr, opNot:
+			r[op.a-registerStart] = arithmetic(op.op, value(r, op.b), value(r, op.c))
+		case opRmem:
+			v := p.read(value(r, op.b))
+			if !isLiteralValue(v) {
+				p.index = int(op.at)
+				return ran, true
+			}
+			r[op.a-registerStart] = v
+		case opWmem:
+			p.write(value(r, op.a), value(r, op.b))
+		case opCall:
+			a := value(r, op.a)
+			if _, hooked := p.hooks[a]; hooked || p.stackLimit > 0 && len(*s) >= p.stackLimit {
+				p.index = int(op.at)
+				return ran, true
+			}
+			p.start = int(op.at)
+			s.push(op.next)
+			p.called(a, s)
+			p.index = int(a)
+		case opRet:
+			if s.isEmpty() {
+				p.index = int(op.at)
+				return ran, true
+			}
+			depth := len(*s)
+			a := s.pop()
+			p.returned(a, depth)
+			p.index = int(a)
+		case opOut:
+			c := rune(value(r, op.a))
+			fmt.Fprint(p.out(), string(c))
+			if p.codes != nil {
+				p.codes.observe(c, p.steps)
+			}
+		}
+		p.steps++
+		ran++
+		if p.checkpoints != nil {
+			p.checkpoints.record(p, r, s, op.at, op.op)
+		}
+	}
+	return ran, false
+}
@@ -0,0 +1,222 @@
+package synacor
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func cachedRun(program []uint16, input string, limit uint64) (string, Machine) {
+	var out bytes.Buffer
+	m := newTestMachine(program)
+	m.SetOutput(&out)
+	m.SetInput(strings.NewReader(input))
+	m.RunCached(limit)
+	return out.String(), m
+}
+
+func TestConformanceCached(t *testing.T) {
+	runConformance(t, cachedRun)
+}
+
+// sameRun fails the test if two Machines didn't end up in the same state.
+func sameRun(t *testing.T, name string, got, want Machine, gotOut, wantOut string) {
+	t.Helper()
+	if got.Stopped() != want.Stopped() || got.PC() != want.PC() || got.Steps() != want.Steps() {
+		t.Error("Got:", got.Stopped(), got.PC(), got.Steps(), "Expected:", want.Stopped(), want.PC(), want.Steps(), "For:", name)
+	}
+	if *got.Registers != *want.Registers || !reflect.DeepEqual(*got.Stack, *want.Stack) {
+		t.Error("Got:", got.Registers, got.Stack, "Expected:", want.Registers, want.Stack, "For:", name)
+	}
+	if !reflect.DeepEqual(got.Image(), want.Image()) || !reflect.DeepEqual(got.Backtrace(), want.Backtrace()) {
+		t.Error("Got:", got.Backtrace(), "Expected:", want.Backtrace(), "and the same memory, For:", name)
+	}
+	if (got.Fault() == nil) != (want.Fault() == nil) || got.Fault() != nil && got.Fault().Error() != want.Fault().Error() {
+		t.Error("Got:", got.Fault(), "Expected:", want.Fault(), "For:", name)
+	}
+	if gotOut != wantOut {
+		t.Errorf("Got: %q Expected: %q For: %s", gotOut, wantOut, name)
+	}
+}
+
+func TestMachineRunCached(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		input string
+		limit uint64
+		// set up the Machine before it runs
+		setup func(m Machine)
+	}{
+		{
+			name: "self-modifying loop",
+			src: `	set r1 3
+loop:	add r0 r0 1
+	wmem loop+3 5
+	out r0
+	add r1 r1 32767
+	jt r1 loop
+	halt`,
+		},
+		{
+			name: "writes the next instruction of its block",
+			src: `	set r0 7
+	wmem next+1 'b'
+next:	out 'a'
+	set r1 r0
+	halt`,
+		},
+		{
+			name:  "reads input between blocks",
+			src:   "read: in r0; out r0; eq r1 r0 '\\n'; jf r1 read; halt",
+			input: "echo\n",
+		},
+		{
+			name: "calls and returns",
+			src:  "call f; call f; halt; f: push r0; add r0 r0 2; pop r1; ret",
+		},
+		{
+			name:  "stops at the limit in a block",
+			src:   "loop: add r0 r0 1; add r1 r1 2; add r2 r2 3; jmp loop",
+			limit: 100,
+		},
+		{
+			name: "faults in a block",
+			src:  "set r0 5; push r0; pop r1; pop r2; out 'x'",
+		},
+		{
+			name: "mod by a register that's zero",
+			src:  "set r0 9; mod r1 r0 r2; halt",
+		},
+		{
+			name:  "stack limit",
+			src:   "f: call f",
+			setup: func(m Machine) { m.SetStackLimit(50) },
+		},
+		{
+			name:  "hooked call",
+			src:   "call 4; halt; noop; noop; ret",
+			setup: func(m Machine) { m.SetHook(4, func(m Machine) error { m.SetRegister(0, 42); return nil }) },
+		},
+		{
+			name:  "failing hook",
+			src:   "call 4; halt; noop; noop; ret",
+			setup: func(m Machine) { m.SetHook(4, func(m Machine) error { return errors.New("broken") }) },
+		},
+		{
+			name: "runs off the end",
+			src:  "set r0 1; add r0 r0 r0",
+		},
+		{
+			name: "ret on an empty stack halts",
+			src:  "set r0 1; ret; out 'x'",
+		},
+	}
+
+	for _, test := range tests {
+		program, err := Assemble(test.src, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		run := func(cached bool) (Machine, string) {
+			var out bytes.Buffer
+			m := newTestMachine(program)
+			m.SetOutput(&out)
+			m.SetInput(strings.NewReader(test.input))
+			if test.setup != nil {
+				test.setup(m)
+			}
+			limit := test.limit
+			if limit == 0 {
+				limit = conformanceLimit
+			}
+			if cached {
+				m.RunCached(limit)
+			} else {
+				m.RunSteps(limit)
+			}
+			return m, out.String()
+		}
+
+		got, gotOut := run(true)
+		want, wantOut := run(false)
+		sameRun(t, test.name, got, want, gotOut, wantOut)
+	}
+}
+
+func TestMachineRunCachedInvalidates(t *testing.T) {
+	m := assembled(t, "loop: out 'a'; jmp loop")
+	m.SetOutput(&bytes.Buffer{})
+	m.RunCached(4)
+
+	// code changed from outside the program is decoded again
+	m.SetMemory(1, 'b')
+	var out bytes.Buffer
+	m.SetOutput(&out)
+	m.RunCached(4)
+	if out.String() != "bb" {
+		t.Errorf("Got: %q Expected: %q", out.String(), "bb")
+	}
+}
+
+// FuzzRunCached runs random memory with and without the block cache, which
+// have to end up the same.
+func FuzzRunCached(f *testing.F) {
+	addPrograms(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		memory, _ := ReadImage(bytes.NewReader(data))
+		if len(memory) > maxMemory+1 {
+			return
+		}
+
+		run := func(cached bool) (Machine, string) {
+			var out bytes.Buffer
+			m := newTestMachine(memory)
+			m.SetOutput(&out)
+			m.SetInput(strings.NewReader("look\n"))
+			if cached {
+				m.RunCached(fuzzSteps)
+			} else {
+				m.RunSteps(fuzzSteps)
+			}
+			return m, out.String()
+		}
+
+		got, gotOut := run(true)
+		want, wantOut := run(false)
+		sameRun(t, "fuzzed memory", got, want, gotOut, wantOut)
+	})
+}
+
+// loopProgram counts r0 down from 10000 r1 times, adding into r2.
+const loopProgram = `	set r1 10
+outer:	set r0 10000
+inner:	add r2 r2 r0
+	mult r3 r2 3
+	add r0 r0 32767
+	jt r0 inner
+	add r1 r1 32767
+	jt r1 outer
+	halt`
+
+func benchmarkRun(b *testing.B, run func(m Machine)) {
+	program, err := Assemble(loopProgram, 0, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for n := 0; n < b.N; n++ {
+		run(newTestMachine(program))
+	}
+}
+
+func BenchmarkRunSteps(b *testing.B) {
+	benchmarkRun(b, func(m Machine) { m.RunSteps(0) })
+}
+
+func BenchmarkRunCached(b *testing.B) {
+	benchmarkRun(b, func(m Machine) { m.RunCached(0) })
+}
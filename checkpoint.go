@@ -0,0 +1,273 @@
+package synacor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// CheckpointKind is why a checkpoint was taken.
+type CheckpointKind uint8
+
+// Kinds of checkpoints.
+const (
+	// Interval checkpoints are taken every so many instructions
+	Interval CheckpointKind = iota
+	Input
+	Output
+)
+
+var checkpointKindNames = map[CheckpointKind]string{
+	Interval: "interval",
+	Input:    "in",
+	Output:   "out",
+}
+
+func (k CheckpointKind) String() string {
+	return checkpointKindNames[k]
+}
+
+// Checkpoint is a hash of the Machine's state after an instruction.  The hash
+// rolls: it takes in the hash of the checkpoint before, so once two runs
+// differ every checkpoint after differs too.
+type Checkpoint struct {
+	// Step is how many instructions had run, counting this one
+	Step uint64
+	// PC is the address of the instruction
+	PC   uint16
+	Kind CheckpointKind
+	// Hash of where the program goes next, the registers, stack and memory,
+	// and the checkpoint before
+	Hash uint64
+}
+
+func (c Checkpoint) String() string {
+	return fmt.Sprintf("step %d at %d (%s) %016x", c.Step, c.PC, c.Kind, c.Hash)
+}
+
+// Magic bytes a checkpoint log starts with.
+var checkpointMagic = []byte("SYNCHECK")
+
+// CheckpointLog writes checkpoints of a Machine's state: after every in and
+// out, and every Every instructions.  The log starts with magic bytes and
+// Every, From and To, followed by the checkpoints, all little endian.
+type CheckpointLog struct {
+	// Every is how many instructions apart interval checkpoints are; 0 is
+	// none, only checkpoints at in and out
+	Every uint64
+	// From and To are the steps interval checkpoints are taken between; To 0
+	// is no end.  Every 1 over a few steps finds exactly where runs differ.
+	From, To uint64
+
+	w    *bufio.Writer
+	err  error
+	hash uint64
+	// sum of every word of memory mixed with its address
+	memory uint64
+}
+
+// NewCheckpointLog returns a CheckpointLog that writes to w and takes interval
+// checkpoints every so many instructions.
+func NewCheckpointLog(w io.Writer, every uint64) *CheckpointLog {
+	return &CheckpointLog{Every: every, w: bufio.NewWriter(w)}
+}
+
+// SetCheckpointLog has the Machine write checkpoints to l as it runs, from
+// now; nil stops it.  Flush the log when the Machine stops.
+func (m Machine) SetCheckpointLog(l *CheckpointLog) {
+	m.Program.checkpoints = l
+	if l == nil {
+		return
+	}
+	l.start(m.Program)
+	l.write(checkpointMagic, l.Every, l.From, l.To)
+}
+
+// Flush writes any checkpoints still buffered, returning the first error
+// writing the log.
+func (l *CheckpointLog) Flush() error {
+	if l.err != nil {
+		return l.err
+	}
+	return l.w.Flush()
+}
+
+// start hashes the program's memory from scratch.
+func (l *CheckpointLog) start(p *program) {
+	l.memory = 0
+	for a, v := range p.memory {
+		l.memory += mixWord(uint16(a), v)
+	}
+}
+
+// wrote keeps the hash of memory up to date with a write.
+func (l *CheckpointLog) wrote(address, old, value uint16) {
+	l.memory += mixWord(address, value) - mixWord(address, old)
+}
+
+// record takes a checkpoint, if one's due, after the instruction at an
+// address.
+func (l *CheckpointLog) record(p *program, r *registers, s *stack, at uint16, op opcode) {
+	kind := Interval
+	switch {
+	case op == opIn:
+		kind = Input
+	case op == opOut:
+		kind = Output
+	case l.Every == 0 || p.steps%l.Every != 0 || p.steps < l.From || l.To > 0 && p.steps > l.To:
+		return
+	}
+
+	h := fnvOffset
+	h = fnvWord(h, l.hash)
+	h = fnvWord(h, p.steps)
+	h = fnvWord(h, uint64(at))
+	h = fnvWord(h, uint64(p.index))
+	for _, v := range r {
+		h = fnvWord(h, uint64(v))
+	}
+	h = fnvWord(h, uint64(len(*s)))
+	for _, v := range *s {
+		h = fnvWord(h, uint64(v))
+	}
+	h = fnvWord(h, l.memory)
+	l.hash = h
+
+	l.write(Checkpoint{Step: p.steps, PC: at, Kind: kind, Hash: h})
+}
+
+func (l *CheckpointLog) write(values ...interface{}) {
+	for _, v := range values {
+		if l.err == nil {
+			l.err = binary.Write(l.w, binary.LittleEndian, v)
+		}
+	}
+}
+
+const (
+	fnvOffset uint64 = 14695981039346656037
+	fnvPrime  uint64 = 1099511628211
+)
+
+// fnvWord hashes the bytes of v into h, FNV-1a.
+func fnvWord(h, v uint64) uint64 {
+	for i := 0; i < 8; i++ {
+		h ^= v & 0xff
+		h *= fnvPrime
+		v >>= 8
+	}
+	return h
+}
+
+// mixWord scatters a word of memory and its address over 64 bits
+// (splitmix64), so memory's hash can be a sum.  Zero words count for nothing,
+// so memory growing doesn't change it.
+func mixWord(address, value uint16) uint64 {
+	if value == 0 {
+		return 0
+	}
+	z := uint64(address)<<16 | uint64(value)
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// Checkpoints is a checkpoint log read back.
+type Checkpoints struct {
+	Every, From, To uint64
+	List            []Checkpoint
+}
+
+// ReadCheckpoints reads a checkpoint log.
+func ReadCheckpoints(r io.Reader) (Checkpoints, error) {
+	c := Checkpoints{}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return c, err
+	}
+	if !bytes.HasPrefix(data, checkpointMagic) {
+		return c, errors.New("not a checkpoint log")
+	}
+
+	b := bytes.NewReader(data[len(checkpointMagic):])
+	for _, v := range []*uint64{&c.Every, &c.From, &c.To} {
+		if err := binary.Read(b, binary.LittleEndian, v); err != nil {
+			return c, fmt.Errorf("reading the header: %v", err)
+		}
+	}
+
+	for b.Len() > 0 {
+		var cp Checkpoint
+		if err := binary.Read(b, binary.LittleEndian, &cp); err != nil {
+			return c, fmt.Errorf("reading checkpoint %d: %v", len(c.List), err)
+		}
+		c.List = append(c.List, cp)
+	}
+	return c, nil
+}
+
+// Divergence is where two runs' checkpoints first differ.
+type Divergence struct {
+	// Index of the first checkpoint that differs
+	Index int
+	// A and B are the runs' checkpoints there, nil for a run that stopped
+	// before it
+	A, B *Checkpoint
+	// After is the step of the last checkpoint the runs agree on, 0 if there
+	// isn't one
+	After uint64
+}
+
+// Exact returns true if the runs differ right after the last checkpoint they
+// agree on, so the instruction that made them differ is known.
+func (d Divergence) Exact() bool {
+	return d.A != nil && d.B != nil && d.A.Step == d.After+1 && d.B.Step == d.After+1
+}
+
+func (d Divergence) String() string {
+	describe := func(c *Checkpoint) string {
+		if c == nil {
+			return "stopped"
+		}
+		return c.String()
+	}
+
+	if d.Exact() {
+		return fmt.Sprintf("runs differ at step %d: the instructions at %d and %d (checkpoint %d: %s, %s)",
+			d.After+1, d.A.PC, d.B.PC, d.Index, describe(d.A), describe(d.B))
+	}
+	return fmt.Sprintf("runs differ after step %d, at checkpoint %d: %s, %s",
+		d.After, d.Index, describe(d.A), describe(d.B))
+}
+
+// CompareCheckpoints returns where two runs' checkpoints first differ, and
+// false if they don't.  Both have to be taken with the same settings.
+func CompareCheckpoints(a, b Checkpoints) (Divergence, bool, error) {
+	if a.Every != b.Every || a.From != b.From || a.To != b.To {
+		return Divergence{}, false, fmt.Errorf("checkpoints taken every %d from %d to %d and every %d from %d to %d can't be compared",
+			a.Every, a.From, a.To, b.Every, b.From, b.To)
+	}
+
+	d := Divergence{}
+	for i := 0; i < len(a.List) || i < len(b.List); i++ {
+		if i < len(a.List) && i < len(b.List) && a.List[i] == b.List[i] {
+			d.After = a.List[i].Step
+			continue
+		}
+
+		d.Index = i
+		if i < len(a.List) {
+			d.A = &a.List[i]
+		}
+		if i < len(b.List) {
+			d.B = &b.List[i]
+		}
+		return d, true, nil
+	}
+	return d, false, nil
+}
@@ -0,0 +1,139 @@
+package synacor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// checkpointProgram echoes a line, then loops writing to memory.
+const checkpointProgram = `read:	in r0
+	out r0
+	eq r1 r0 '\n'
+	jf r1 read
+	set r2 100
+loop:	wmem r2 r2
+	add r2 r2 1
+	gt r1 r2 200
+	jf r1 loop
+	halt`
+
+// recorded runs checkpointProgram, returning the checkpoints it wrote.  setup
+// changes the log's settings and tamper the Machine before it runs.
+func recorded(t *testing.T, cached bool, setup func(l *CheckpointLog), tamper func(m Machine)) (Checkpoints, []byte) {
+	t.Helper()
+	m := assembled(t, checkpointProgram)
+	m.SetOutput(&bytes.Buffer{})
+	m.SetInput(strings.NewReader("hi\n"))
+
+	var b bytes.Buffer
+	l := NewCheckpointLog(&b, 50)
+	if setup != nil {
+		setup(l)
+	}
+	m.SetCheckpointLog(l)
+	if tamper != nil {
+		tamper(m)
+	}
+	if cached {
+		m.RunCached(conformanceLimit)
+	} else {
+		m.RunSteps(conformanceLimit)
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ReadCheckpoints(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, b.Bytes()
+}
+
+func TestCheckpointLog(t *testing.T) {
+	c, _ := recorded(t, false, nil, nil)
+
+	kinds := ""
+	for _, cp := range c.List {
+		kinds += cp.Kind.String()[:1]
+	}
+	// in and out for each character, then every 50 steps up to 418
+	if want := "ioioioiiiiiiii"; kinds != want || c.Every != 50 {
+		t.Errorf("Got: %q every %d Expected: %q every 50", kinds, c.Every, want)
+	}
+	if c.List[1].Step != 2 || c.List[1].PC != 2 || c.List[13].Step != 400 {
+		t.Error("Got:", c.List[1], c.List[8], "Expected: step 2 at 2 and step 400")
+	}
+}
+
+func TestCheckpointLogCached(t *testing.T) {
+	_, got := recorded(t, true, nil, nil)
+	_, want := recorded(t, false, nil, nil)
+	if !bytes.Equal(got, want) {
+		t.Error("Got different checkpoints with the block cache")
+	}
+}
+
+func TestCompareCheckpoints(t *testing.T) {
+	a, _ := recorded(t, false, nil, nil)
+	if _, differ, err := CompareCheckpoints(a, a); differ || err != nil {
+		t.Error("Got:", differ, err, "Expected: the same")
+	}
+
+	// a VM that gets something wrong after 13 steps
+	wrong := func(m Machine) {
+		m.RunSteps(13)
+		m.SetMemory(300, 7)
+	}
+	b, _ := recorded(t, false, nil, wrong)
+	d, differ, err := CompareCheckpoints(a, b)
+	if !differ || err != nil || d.Index != 6 || d.After != 10 || d.A.Step != 50 || d.Exact() {
+		t.Error("Got:", d, differ, err, "Expected: different after step 10, at step 50")
+	}
+
+	// checkpoints at every step from there find it
+	fine := func(l *CheckpointLog) { l.Every, l.From = 1, d.After+1 }
+	a, _ = recorded(t, false, fine, nil)
+	b, _ = recorded(t, false, fine, wrong)
+	d, differ, err = CompareCheckpoints(a, b)
+	if !differ || err != nil || !d.Exact() || d.After+1 != 14 || d.A.PC != 14 {
+		t.Error("Got:", d, differ, err, "Expected: step 14 at 14")
+	}
+
+	// a run that stops early differs where it stops
+	b.List = b.List[:3]
+	if d, differ, _ = CompareCheckpoints(a, b); !differ || d.Index != 3 || d.B != nil {
+		t.Error("Got:", d, "Expected: the second run stopped at checkpoint 3")
+	}
+
+	b.Every = 2
+	if _, _, err := CompareCheckpoints(a, b); err == nil {
+		t.Error("Got:", err, "Expected: an error comparing different settings")
+	}
+}
+
+func TestCheckpointLogMemory(t *testing.T) {
+	m := newTestMachine([]uint16{1, 2, 3})
+	l := NewCheckpointLog(&bytes.Buffer{}, 0)
+	m.SetCheckpointLog(l)
+
+	m.SetMemory(1, 9)
+	m.SetMemory(40, 5)
+	m.SetMemory(40, 0)
+	got := l.memory
+	l.start(m.Program)
+	if got != l.memory {
+		t.Error("Got:", got, "Expected:", l.memory)
+	}
+}
+
+func TestReadCheckpoints(t *testing.T) {
+	if _, err := ReadCheckpoints(strings.NewReader("not a log")); err == nil {
+		t.Error("Got:", err, "Expected: an error")
+	}
+	_, data := recorded(t, false, nil, nil)
+	if _, err := ReadCheckpoints(bytes.NewReader(data[:len(data)-3])); err == nil {
+		t.Error("Got:", err, "Expected: an error for a cut off checkpoint")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pladdy/synacor"
+)
+
+func main() {
+	register := flag.Int("register", 7, "register (0-7) to try values in")
+	from := flag.Uint("from", 1, "first value to try")
+	to := flag.Uint("to", 32767, "last value to try")
+	input := flag.String("input", "", "file with the commands to feed the game")
+	want := flag.String("want", "", "only report values whose output contains this")
+	steps := flag.Uint64("steps", 10000000, "instructions each value may run (0 is no limit)")
+	workers := flag.Int("workers", 0, "values to run at once (default number of CPUs)")
+	cached := flag.Bool("cached", false, "run blocks of decoded instructions instead of decoding every one")
+	flag.Parse()
+
+	if *register < 0 || *register > 7 || *to > 32767 || *from > *to {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	commands := ""
+	if *input != "" {
+		b, err := ioutil.ReadFile(filepath.Clean(*input))
+		if err != nil {
+			panic(err)
+		}
+		commands = string(b)
+	}
+
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	if err := m.Load("./challenge.bin"); err != nil {
+		panic(err)
+	}
+
+	h := synacor.Harness{Workers: *workers, MaxSteps: *steps, Cached: *cached}
+	if *want != "" {
+		h.Keep = synacor.OutputContains(*want)
+	}
+
+	variants := synacor.RegisterRange(*register, uint16(*from), uint16(*to), commands)
+	for _, r := range h.Run(m, variants) {
+		fmt.Printf("r%d = %d: %s after %d steps\n", *register, r.Variant.Registers[*register], r.Stop, r.Steps)
+		if r.Fault != nil {
+			fmt.Printf("  %s\n", r.Fault)
+		}
+	}
+}
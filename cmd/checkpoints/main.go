@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+const usage = `Usage:
+  checkpoints record [flags] <binary>  run a binary, writing checkpoints of its state
+  checkpoints compare <log> <log>      find where two runs first differ
+
+A checkpoint hashes the VM's registers, stack and memory after every in and out
+and every so many instructions.  Record runs of a binary before and after
+changing the VM and compare them; when they differ, record both again with
+'-every 1 -from <step>' to find the exact instruction.  'checkpoints record -h'
+lists the flags.`
+
+func record(args []string) error {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	every := flags.Uint64("every", 10000, "instructions between checkpoints (0 is only at in and out)")
+	from := flags.Uint64("from", 0, "first step to take interval checkpoints at")
+	to := flags.Uint64("to", 0, "last step to take interval checkpoints at (0 is no end)")
+	input := flags.String("input", "", "file with the commands to feed the program")
+	steps := flags.Uint64("steps", 0, "instructions to run at most (0 is no limit)")
+	cached := flags.Bool("cached", false, "run with the block cache instead of the interpreter")
+	output := flags.String("o", "checkpoints.log", "file to write the checkpoints to")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("record takes one binary, got %d", flags.NArg())
+	}
+
+	commands := ""
+	if *input != "" {
+		b, err := ioutil.ReadFile(filepath.Clean(*input))
+		if err != nil {
+			return err
+		}
+		commands = string(b)
+	}
+
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	if err := m.Load(flags.Arg(0)); err != nil {
+		return err
+	}
+	m.SetOutput(ioutil.Discard)
+	m.SetInput(strings.NewReader(commands))
+
+	fh, err := os.Create(filepath.Clean(*output))
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	l := synacor.NewCheckpointLog(fh, *every)
+	l.From, l.To = *from, *to
+	m.SetCheckpointLog(l)
+
+	var stop synacor.StopReason
+	if *cached {
+		stop = m.RunCached(*steps)
+	} else {
+		stop = m.RunSteps(*steps)
+	}
+	if err := l.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s after %d steps; checkpoints written to %s\n", stop, m.Steps(), *output)
+	return nil
+}
+
+func read(file string) (synacor.Checkpoints, error) {
+	fh, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return synacor.Checkpoints{}, err
+	}
+	defer fh.Close()
+
+	c, err := synacor.ReadCheckpoints(fh)
+	if err != nil {
+		return c, fmt.Errorf("%s: %v", file, err)
+	}
+	return c, nil
+}
+
+// compare returns true if the runs are the same.
+func compare(args []string) (bool, error) {
+	if len(args) != 2 {
+		return false, fmt.Errorf("compare takes two logs, got %d", len(args))
+	}
+
+	a, err := read(args[0])
+	if err != nil {
+		return false, err
+	}
+	b, err := read(args[1])
+	if err != nil {
+		return false, err
+	}
+
+	d, differ, err := synacor.CompareCheckpoints(a, b)
+	if err != nil {
+		return false, err
+	}
+	if !differ {
+		fmt.Printf("runs are the same: %d checkpoints\n", len(a.List))
+		return true, nil
+	}
+
+	fmt.Println(d)
+	if !d.Exact() {
+		fmt.Printf("record both again with -every 1 -from %d to find the instruction\n", d.After+1)
+	}
+	return false, nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	same := true
+	switch os.Args[1] {
+	case "record":
+		err = record(os.Args[2:])
+	case "compare":
+		same, err = compare(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if !same {
+		os.Exit(1)
+	}
+}
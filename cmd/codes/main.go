@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pladdy/synacor"
+)
+
+const usage = `Usage:
+  codes extract [transcript]   list the codes found in a transcript
+  codes mirror <code>...       print the mirror image of each code
+  codes mirror -f [transcript] print the mirror image of every code in a transcript
+
+A transcript is the game's output, e.g. 'make vm | tee transcript.txt'.  When
+no transcript file is given it's read from stdin.`
+
+// readTranscript reads the file at path, or stdin if path is empty.
+func readTranscript(path string) (string, error) {
+	var r io.Reader = os.Stdin
+
+	if path != "" {
+		fh, err := os.Open(filepath.Clean(path))
+		if err != nil {
+			return "", err
+		}
+		defer fh.Close()
+		r = fh
+	}
+
+	b, err := ioutil.ReadAll(r)
+	return string(b), err
+}
+
+func extract(args []string) error {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	transcript, err := readTranscript(path)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range synacor.ExtractCodes(transcript) {
+		fmt.Println(code)
+	}
+	return nil
+}
+
+func mirror(args []string) error {
+	if len(args) > 0 && args[0] == "-f" {
+		path := ""
+		if len(args) > 1 {
+			path = args[1]
+		}
+
+		transcript, err := readTranscript(path)
+		if err != nil {
+			return err
+		}
+		args = synacor.ExtractCodes(transcript)
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("no codes to mirror")
+	}
+
+	for _, code := range args {
+		fmt.Println(code, "->", synacor.Mirror(code))
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "extract":
+		err = extract(os.Args[2:])
+	case "mirror":
+		err = mirror(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The equation as it's written on the monument in the game.
+const defaultEquation = "_ + _ * _^2 + _^3 - _ = 399"
+
+type coin struct {
+	name  string
+	value int
+}
+
+// equation is a parsed template; each '_' is a slot a coin gets placed in.
+type equation struct {
+	lhs    node
+	rhs    node
+	blanks int
+}
+
+// node is a piece of the parsed expression that can be evaluated with the
+// values placed in the blanks.  eval returns false if the values can't be
+// evaluated: division by zero or a negative exponent.
+type node interface {
+	eval(slots []int) (int, bool)
+}
+
+type number int
+
+func (n number) eval(slots []int) (int, bool) {
+	return int(n), true
+}
+
+type blank int
+
+func (b blank) eval(slots []int) (int, bool) {
+	return slots[b], true
+}
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+func (b binary) eval(slots []int) (int, bool) {
+	l, ok := b.left.eval(slots)
+	if !ok {
+		return 0, false
+	}
+	r, ok := b.right.eval(slots)
+	if !ok {
+		return 0, false
+	}
+
+	switch b.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	case '/':
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	case '^':
+		if r < 0 {
+			return 0, false
+		}
+		v := 1
+		for i := 0; i < r; i++ {
+			v *= l
+		}
+		return v, true
+	}
+	panic(fmt.Sprintf("unknown operator %q", b.op))
+}
+
+// parser is a small recursive descent parser for the equation template:
+//   expr  = term { ("+" | "-") term }
+//   term  = power { ("*" | "/") power }
+//   power = atom [ "^" atom ]
+//   atom  = "_" | number | "(" expr ")"
+type parser struct {
+	s      string
+	pos    int
+	blanks int
+}
+
+func parseEquation(s string) (equation, error) {
+	sides := strings.Split(s, "=")
+	if len(sides) != 2 {
+		return equation{}, errors.New("equation needs exactly one '='")
+	}
+
+	p := &parser{s: sides[0]}
+	lhs, err := p.parse()
+	if err != nil {
+		return equation{}, err
+	}
+	blanks := p.blanks
+
+	p = &parser{s: sides[1]}
+	rhs, err := p.parse()
+	if err != nil {
+		return equation{}, err
+	}
+	if p.blanks > 0 {
+		return equation{}, errors.New("blanks are only allowed left of '='")
+	}
+
+	return equation{lhs: lhs, rhs: rhs, blanks: blanks}, nil
+}
+
+// solved returns true if the values placed in the blanks satisfy the equation.
+func (e equation) solved(slots []int) bool {
+	l, ok := e.lhs.eval(slots)
+	if !ok {
+		return false
+	}
+	r, ok := e.rhs.eval(slots)
+	return ok && l == r
+}
+
+func (p *parser) parse() (node, error) {
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 0 {
+		return nil, fmt.Errorf("unexpected %q at %d", p.peek(), p.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() byte {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (node, error) {
+	left, err := p.power()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.power()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) power() (node, error) {
+	base, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+
+	exp, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	return binary{'^', base, exp}, nil
+}
+
+func (p *parser) atom() (node, error) {
+	switch c := p.peek(); {
+	case c == '_':
+		p.pos++
+		b := blank(p.blanks)
+		p.blanks++
+		return b, nil
+	case c == '(':
+		p.pos++
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' at %d", p.pos)
+		}
+		p.pos++
+		return n, nil
+	case c >= '0' && c <= '9':
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		v, err := strconv.Atoi(p.s[start:p.pos])
+		return number(v), err
+	case c == 0:
+		return nil, errors.New("unexpected end of equation")
+	default:
+		return nil, fmt.Errorf("unexpected %q at %d", c, p.pos)
+	}
+}
+
+// parseCoins reads a list like "red coin=2,blue coin=9".
+func parseCoins(s string) ([]coin, error) {
+	coins := []coin{}
+
+	for _, field := range strings.Split(s, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("coin %q should look like 'name=value'", field)
+		}
+
+		v, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("coin %q has a bad value: %v", field, err)
+		}
+		coins = append(coins, coin{strings.TrimSpace(kv[0]), v})
+	}
+	return coins, nil
+}
+
+// solve tries every ordering of the coins in the blanks of the equation and
+// returns the first ordering that balances it.
+func solve(e equation, coins []coin) ([]coin, error) {
+	if len(coins) != e.blanks {
+		return nil, fmt.Errorf("equation has %d blanks but %d coins were given", e.blanks, len(coins))
+	}
+
+	order := make([]coin, len(coins))
+	copy(order, coins)
+	slots := make([]int, len(coins))
+
+	var permute func(k int) bool
+	permute = func(k int) bool {
+		if k == len(order) {
+			for i, c := range order {
+				slots[i] = c.value
+			}
+			return e.solved(slots)
+		}
+
+		for i := k; i < len(order); i++ {
+			order[k], order[i] = order[i], order[k]
+			if permute(k + 1) {
+				return true
+			}
+			order[k], order[i] = order[i], order[k]
+		}
+		return false
+	}
+
+	if !permute(0) {
+		return nil, errors.New("no ordering of the coins solves the equation")
+	}
+	return order, nil
+}
+
+// writeCommands writes the game input, one command per line, so it can be fed
+// to cmd/vm.
+func writeCommands(w io.Writer, coins []coin) error {
+	for _, c := range coins {
+		if _, err := fmt.Fprintf(w, "use %s\n", c.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	eq := flag.String("equation", defaultEquation, "equation template, '_' marks a coin slot")
+	coinList := flag.String("coins", "", "coins as 'name=value' pairs separated by commas, e.g. 'red coin=2,blue coin=9'")
+	output := flag.String("o", "", "file to write the commands to (default stdout)")
+	flag.Parse()
+
+	e, err := parseEquation(*eq)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Bad equation:", err)
+		os.Exit(1)
+	}
+
+	coins, err := parseCoins(*coinList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Bad coins:", err)
+		os.Exit(1)
+	}
+
+	solution, err := solve(e, coins)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		w, err = os.Create(filepath.Clean(*output))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if err := writeCommands(w, solution); err != nil {
+		panic(err)
+	}
+
+	if w != os.Stdout {
+		if err := w.Close(); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseEquation(t *testing.T) {
+	tests := []struct {
+		equation string
+		slots    []int
+		expected bool
+	}{
+		{"_ + _ = 3", []int{1, 2}, true},
+		{"_ + _ = 3", []int{2, 2}, false},
+		{"_ * _^2 = 18", []int{2, 3}, true},
+		{"(_ + _) * _ = 9", []int{1, 2, 3}, true},
+		{"_ - _ / _ = 3", []int{5, 4, 2}, true},
+		{"_ / _ = 1", []int{1, 1}, true},
+		{"_ / _ = 1", []int{1, 0}, false},
+		{"_ ^ (_ - 3) = 1", []int{1, 2}, false},
+	}
+
+	for _, test := range tests {
+		e, err := parseEquation(test.equation)
+		if err != nil {
+			t.Fatal("Got:", err, "Expected:", nil)
+		}
+
+		result := e.solved(test.slots)
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected, "Equation:", test.equation)
+		}
+	}
+}
+
+func TestParseEquationErrors(t *testing.T) {
+	tests := []string{"_ + _", "_ + = 3", "_ + _ = _", "(_ + _ = 3", "_ & _ = 1"}
+
+	for _, test := range tests {
+		if _, err := parseEquation(test); err == nil {
+			t.Error("Expected an error for:", test)
+		}
+	}
+}
+
+func TestParseCoins(t *testing.T) {
+	coins, err := parseCoins("red coin=2, blue coin = 9")
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	expected := []coin{{"red coin", 2}, {"blue coin", 9}}
+	if len(coins) != len(expected) {
+		t.Fatal("Got:", coins, "Expected:", expected)
+	}
+	for i := range expected {
+		if coins[i] != expected[i] {
+			t.Error("Got:", coins[i], "Expected:", expected[i])
+		}
+	}
+
+	if _, err := parseCoins("red coin"); err == nil {
+		t.Error("Expected an error for a coin without a value")
+	}
+}
+
+func TestSolve(t *testing.T) {
+	e, err := parseEquation(defaultEquation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coins := []coin{{"a", 2}, {"b", 3}, {"c", 5}, {"d", 7}, {"e", 9}}
+	solution, err := solve(e, coins)
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	var b bytes.Buffer
+	if err := writeCommands(&b, solution); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "use e\nuse a\nuse c\nuse d\nuse b\n"
+	if b.String() != expected {
+		t.Error("Got:", b.String(), "Expected:", expected)
+	}
+}
+
+func TestSolveNoSolution(t *testing.T) {
+	e, err := parseEquation("_ + _ = 100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := solve(e, []coin{{"a", 1}, {"b", 2}}); err == nil {
+		t.Error("Expected an error when there's no solution")
+	}
+	if _, err := solve(e, []coin{{"a", 1}}); err == nil {
+		t.Error("Expected an error when coins don't fill the blanks")
+	}
+}
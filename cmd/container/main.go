@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+const usage = `Usage:
+  container wrap [flags] <binary>   wrap a binary in a container with metadata
+  container info <file>             print a container's metadata
+  container unwrap <file> <binary>  write the raw image in a container
+
+A container is a binary with a title, author, entry point, initial registers,
+symbols and a checksum.  The VM and tools load containers and raw binaries
+alike.  'container wrap -h' lists the metadata flags.`
+
+func wrap(args []string) error {
+	flags := flag.NewFlagSet("wrap", flag.ExitOnError)
+	title := flags.String("title", "", "title of the program")
+	author := flags.String("author", "", "author of the program")
+	entry := flags.Uint("entry", 0, "address execution starts at")
+	registers := flags.String("registers", "", "initial registers, comma separated from r0")
+	symbols := flags.String("symbols", "", "symbols file naming addresses")
+	output := flags.String("o", "", "file to write the container to (default <binary>.syn)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("wrap takes one binary, got %d", flags.NArg())
+	}
+
+	c, err := synacor.LoadProgram(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *title != "" {
+		c.Title = *title
+	}
+	if *author != "" {
+		c.Author = *author
+	}
+	if *entry > 32767 {
+		return fmt.Errorf("entry %d is past the end of memory", *entry)
+	}
+	if *entry != 0 {
+		c.Entry = uint16(*entry)
+	}
+
+	if *registers != "" {
+		values := strings.Split(*registers, ",")
+		if len(values) > len(c.Registers) {
+			return fmt.Errorf("%d registers given, there are only %d", len(values), len(c.Registers))
+		}
+		for n, v := range values {
+			value, err := strconv.ParseUint(strings.TrimSpace(v), 10, 15)
+			if err != nil {
+				return fmt.Errorf("bad value for r%d: %q", n, v)
+			}
+			c.Registers[n] = uint16(value)
+		}
+	}
+
+	if *symbols != "" {
+		if c.Symbols, err = synacor.LoadSymbols(*symbols); err != nil {
+			return err
+		}
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(flags.Arg(0), filepath.Ext(flags.Arg(0))) + ".syn"
+	}
+	return writeFile(*output, c.Write)
+}
+
+func info(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("info takes one file, got %d", len(args))
+	}
+
+	c, err := synacor.LoadProgram(args[0])
+	if err != nil {
+		return err
+	}
+
+	symbols := 0
+	if c.Symbols != nil {
+		symbols = len(c.Symbols.All())
+	}
+
+	fmt.Println("Title:    ", c.Title)
+	fmt.Println("Author:   ", c.Author)
+	fmt.Println("Entry:    ", c.Symbols.Name(c.Entry))
+	fmt.Println("Registers:", c.Registers)
+	fmt.Println("Words:    ", len(c.Image))
+	fmt.Println("Symbols:  ", symbols)
+	return nil
+}
+
+func unwrap(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("unwrap takes a container and a binary to write, got %d files", len(args))
+	}
+
+	c, err := synacor.LoadProgram(args[0])
+	if err != nil {
+		return err
+	}
+
+	return writeFile(args[1], func(w io.Writer) error {
+		return binary.Write(w, binary.LittleEndian, c.Image)
+	})
+}
+
+// writeFile creates a file and has write fill it.
+func writeFile(file string, write func(io.Writer) error) error {
+	fh, err := os.Create(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	if err := write(fh); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "wrap":
+		err = wrap(os.Args[2:])
+	case "info":
+		err = info(os.Args[2:])
+	case "unwrap":
+		err = unwrap(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pladdy/synacor/dap"
+	"github.com/pladdy/synacor/remote"
+)
+
+func main() {
+	listen := flag.String("listen", "", "serve editors on a TCP address or unix:<path> instead of stdin and stdout")
+	flag.Parse()
+
+	if *listen == "" {
+		if err := dap.NewSession(os.Stdin, os.Stdout).Serve(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	l, err := remote.Listen(*listen)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(os.Stderr, "Debug adapter on", l.Addr())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			panic(err)
+		}
+		go func() {
+			defer conn.Close()
+			if err := dap.NewSession(conn, conn).Serve(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+}
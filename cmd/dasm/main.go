@@ -1,21 +1,47 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 
 	"github.com/pladdy/synacor"
 )
 
+// Operations that take an address to jump to, and which argument it is.
+var jumpTargets = map[string]int{"call": 0, "jmp": 0, "jt": 1, "jf": 1}
+
 func main() {
+	symbolsFile := flag.String("symbols", "", "symbols file naming addresses in the program")
+	flag.Parse()
+
+	var symbols *synacor.Symbols
+	if *symbolsFile != "" {
+		var err error
+		if symbols, err = synacor.LoadSymbols(*symbolsFile); err != nil {
+			panic(err)
+		}
+	}
+
 	m := synacor.NewMachine()
-	m.Load("./challenge.bin")
+	if err := m.Load("./challenge.bin"); err != nil {
+		panic(err)
+	}
 
 	i := 0
 	for m.HasMoreOps() {
+		address := uint16(m.PC())
+		if sym, ok := symbols.Lookup(address); ok {
+			fmt.Printf("\n%s: (%s) %s\n", sym.Name, sym.Type, sym.Comment)
+		}
+
 		opname, opcode, args := m.NextOp()
-		fmt.Printf("Index: %d, Operation: %s (%d), Args: %d", i, opname, opcode, args)
-		if opcode == 19 {
-			fmt.Printf(" %s", string(args[0]))
+		fmt.Printf("Index: %d, Address: %s, Operation: %s (%d), Args: %d", i, symbols.Name(address), opname, opcode, args)
+		// a truncated out has no name, and no argument to print
+		if opname == "out" {
+			fmt.Printf(" %s", string(rune(args[0])))
+		}
+		if n, ok := jumpTargets[opname]; ok && n < len(args) && args[n] <= 32767 {
+			fmt.Printf(" -> %s", symbols.Name(args[n]))
 		}
 		fmt.Println()
 		i = i + 1
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pladdy/synacor"
+)
+
+// function returns the address of a function, given its address or name.
+func function(s string, symbols *synacor.Symbols) (uint16, error) {
+	if n, err := strconv.ParseUint(s, 10, 15); err == nil {
+		return uint16(n), nil
+	}
+	for _, sym := range symbols.All() {
+		if sym.Name == s {
+			return sym.Address, nil
+		}
+	}
+	return 0, fmt.Errorf("no function %q", s)
+}
+
+func main() {
+	symbolsFile := flag.String("symbols", "", "symbols file naming functions and labels")
+	name := flag.String("function", "", "function to decompile, by address or name; all of them if empty")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: decompile [-symbols file] [-function name] <binary or container>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := synacor.LoadProgram(flag.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+
+	symbols := c.Symbols
+	if *symbolsFile != "" {
+		if symbols, err = synacor.LoadSymbols(*symbolsFile); err != nil {
+			panic(err)
+		}
+	}
+
+	d := synacor.NewDecompiler(c.Image, symbols)
+	functions := d.Functions()
+	if *name != "" {
+		address, err := function(*name, symbols)
+		if err != nil {
+			panic(err)
+		}
+		functions = []uint16{address}
+	}
+
+	for n, address := range functions {
+		if n > 0 {
+			fmt.Println()
+		}
+		fmt.Print(d.Decompile(address).Code)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// What the game prints when it wants a command.
+const prompt = "What do you do?"
+
+// room is a room as the game describes it.
+type room struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Exits are the rooms each exit leads to; an empty ID is an exit that
+	// ended the game or didn't lead to a room
+	Exits map[string]string `json:"exits"`
+	Items []string          `json:"items,omitempty"`
+	// Path is the commands that get to the room from the start
+	Path []string `json:"path"`
+
+	// key tells rooms apart; rooms that read the same can have different keys
+	key   string
+	exits []string
+}
+
+// outcome is what happened after playing a path of commands.
+type outcome struct {
+	// text the game printed in response to the last command
+	text string
+	// key of the room the game is in, if it can tell; otherwise rooms are told
+	// apart by their text
+	key string
+	// ended is true if the game stopped rather than asking for a command
+	ended bool
+}
+
+// player plays each path of commands on a fresh game and returns what
+// happened, in the same order.
+type player func(paths [][]string) []outcome
+
+// parseRoom reads the room described in text, the last one if there are
+// several.
+func parseRoom(text string) (room, bool) {
+	r := room{Exits: make(map[string]string)}
+
+	start := strings.LastIndex(text, "\n== ")
+	if start < 0 && strings.HasPrefix(text, "== ") {
+		start = 0
+	}
+	if start < 0 {
+		return r, false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(text[start:]))
+	var list *[]string
+	description := []string{}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case r.Title == "" && strings.HasPrefix(line, "== ") && strings.HasSuffix(line, " =="):
+			r.Title = strings.TrimSuffix(strings.TrimPrefix(line, "== "), " ==")
+		case line == "":
+			list = nil
+		case strings.HasPrefix(line, "There ") && strings.Contains(line, " exit"):
+			list = &r.exits
+		case strings.HasPrefix(line, "Things of interest"):
+			list = &r.Items
+		case strings.HasPrefix(line, "- ") && list != nil:
+			*list = append(*list, strings.TrimPrefix(line, "- "))
+		case line == prompt:
+			// the end of the room
+		case list == nil && len(r.exits) == 0 && len(r.Items) == 0:
+			description = append(description, line)
+		}
+	}
+
+	r.Description = strings.Join(description, " ")
+	for _, e := range r.exits {
+		r.Exits[e] = ""
+	}
+	return r, r.Title != ""
+}
+
+// textKey tells rooms apart by everything they say about themselves.
+func (r room) textKey() string {
+	exits := append([]string(nil), r.exits...)
+	sort.Strings(exits)
+	return r.Title + "\n" + r.Description + "\n" + strings.Join(exits, ",")
+}
+
+// explore maps the rooms reachable from where the game starts, breadth
+// first, up to max rooms.
+func explore(play player, max int) ([]*room, error) {
+	start := play([][]string{{}})[0]
+	first, ok := parseRoom(start.text)
+	if !ok {
+		return nil, fmt.Errorf("the game didn't start in a room: %q", start.text)
+	}
+
+	rooms := []*room{}
+	byKey := make(map[string]*room)
+	add := func(r room, key string, path []string) *room {
+		if key == "" {
+			key = r.textKey()
+		}
+		if found, ok := byKey[key]; ok {
+			return found
+		}
+
+		r.ID = fmt.Sprintf("r%d", len(rooms))
+		r.key = key
+		r.Path = path
+		rooms = append(rooms, &r)
+		byKey[key] = &r
+		return &r
+	}
+
+	frontier := []*room{add(first, start.key, []string{})}
+	for len(frontier) > 0 && len(rooms) < max {
+		type move struct {
+			from *room
+			exit string
+		}
+		moves := []move{}
+		paths := [][]string{}
+		for _, r := range frontier {
+			for _, e := range r.exits {
+				moves = append(moves, move{r, e})
+				paths = append(paths, append(append([]string(nil), r.Path...), "go "+e))
+			}
+		}
+
+		frontier = nil
+		for i, o := range play(paths) {
+			to, ok := parseRoom(o.text)
+			if o.ended || !ok {
+				continue
+			}
+
+			before := len(rooms)
+			found := add(to, o.key, paths[i])
+			moves[i].from.Exits[moves[i].exit] = found.ID
+			if len(rooms) > before {
+				frontier = append(frontier, found)
+			}
+			if len(rooms) >= max {
+				break
+			}
+		}
+	}
+	return rooms, nil
+}
+
+func writeJSON(w io.Writer, rooms []*room) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rooms)
+}
+
+// writeDOT writes the map as a Graphviz graph; exits that end the game or go
+// nowhere lead to a single "?" node.
+func writeDOT(w io.Writer, rooms []*room) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph map {")
+	fmt.Fprintln(bw, `  node [shape=box];`)
+
+	nowhere := false
+	for _, r := range rooms {
+		fmt.Fprintf(bw, "  %s [label=%q];\n", r.ID, r.Title)
+	}
+	for _, r := range rooms {
+		exits := make([]string, 0, len(r.Exits))
+		for e := range r.Exits {
+			exits = append(exits, e)
+		}
+		sort.Strings(exits)
+
+		for _, e := range exits {
+			to := r.Exits[e]
+			if to == "" {
+				to, nowhere = "nowhere", true
+			}
+			fmt.Fprintf(bw, "  %s -> %s [label=%q];\n", r.ID, to, e)
+		}
+	}
+	if nowhere {
+		fmt.Fprintln(bw, `  nowhere [label="?", shape=circle];`)
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pladdy/synacor"
+)
+
+const foothills = `Welcome to the game!
+
+== Foothills ==
+You find yourself standing at the base of an enormous mountain.
+
+Things of interest here:
+- tablet
+
+There are 2 exits:
+- doorway
+- south
+
+What do you do?`
+
+func TestParseRoom(t *testing.T) {
+	r, ok := parseRoom(foothills)
+	if !ok {
+		t.Fatal("Got:", ok, "Expected:", true)
+	}
+
+	if r.Title != "Foothills" {
+		t.Error("Got:", r.Title, "Expected:", "Foothills")
+	}
+	if r.Description != "You find yourself standing at the base of an enormous mountain." {
+		t.Error("Got:", r.Description)
+	}
+	if !reflect.DeepEqual(r.Items, []string{"tablet"}) {
+		t.Error("Got:", r.Items, "Expected:", []string{"tablet"})
+	}
+	if !reflect.DeepEqual(r.exits, []string{"doorway", "south"}) {
+		t.Error("Got:", r.exits, "Expected:", []string{"doorway", "south"})
+	}
+
+	if _, ok := parseRoom("You can't go that way.\n\n"); ok {
+		t.Error("Got:", ok, "Expected:", false)
+	}
+}
+
+// testRoom is a room in a fake game.
+type testRoom struct {
+	title string
+	exits map[string]string
+}
+
+// testGame is a fake game: a hall, two passages that read the same and a pit
+// that ends the game.
+var testGame = map[string]testRoom{
+	"hall": {"Hall", map[string]string{"east": "east", "west": "west"}},
+	"east": {"Passage", map[string]string{"west": "hall", "down": "pit"}},
+	"west": {"Passage", map[string]string{"west": "hall", "down": "pit"}},
+	"pit":  {"", nil},
+}
+
+// testPlayer plays paths in testGame, keying rooms by name if keyed.
+func testPlayer(keyed bool) player {
+	return func(paths [][]string) []outcome {
+		outcomes := []outcome{}
+		for _, path := range paths {
+			name := "hall"
+			for _, command := range path {
+				name = testGame[name].exits[strings.TrimPrefix(command, "go ")]
+			}
+
+			r := testGame[name]
+			if r.title == "" {
+				outcomes = append(outcomes, outcome{text: "You fall.", ended: true})
+				continue
+			}
+
+			exits := []string{}
+			for e := range r.exits {
+				exits = append(exits, "- "+e)
+			}
+			sort.Strings(exits)
+
+			o := outcome{text: fmt.Sprintf("\n== %s ==\nA room.\n\nThere are %d exits:\n%s\n\n", r.title, len(exits), strings.Join(exits, "\n"))}
+			if keyed {
+				o.key = name
+			}
+			outcomes = append(outcomes, o)
+		}
+		return outcomes
+	}
+}
+
+func TestExplore(t *testing.T) {
+	tests := []struct {
+		keyed    bool
+		max      int
+		expected map[string]map[string]string
+	}{
+		// the passages read the same, so without keys they're one room
+		{false, 100, map[string]map[string]string{
+			"Hall":    {"east": "r1", "west": "r1"},
+			"Passage": {"west": "r0", "down": ""},
+		}},
+		{true, 100, map[string]map[string]string{
+			"Hall":    {"east": "r1", "west": "r2"},
+			"Passage": {"west": "r0", "down": ""},
+		}},
+		{true, 2, map[string]map[string]string{
+			"Hall":    {"east": "r1", "west": ""},
+			"Passage": {"west": "", "down": ""},
+		}},
+	}
+
+	for _, test := range tests {
+		rooms, err := explore(testPlayer(test.keyed), test.max)
+		if err != nil {
+			t.Fatal("Got:", err, "Expected:", nil)
+		}
+
+		for _, r := range rooms {
+			if !reflect.DeepEqual(r.Exits, test.expected[r.Title]) {
+				t.Error("Got:", r.Exits, "Expected:", test.expected[r.Title], "In:", r.Title, r.ID)
+			}
+		}
+		if test.keyed && test.max == 100 {
+			if len(rooms) != 3 || !reflect.DeepEqual(rooms[2].Path, []string{"go west"}) {
+				t.Error("Got:", len(rooms), rooms[len(rooms)-1].Path, "Expected:", 3, []string{"go west"})
+			}
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	rooms, _ := explore(testPlayer(false), 100)
+
+	var b bytes.Buffer
+	if err := writeDOT(&b, rooms); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `digraph map {
+  node [shape=box];
+  r0 [label="Hall"];
+  r1 [label="Passage"];
+  r0 -> r1 [label="east"];
+  r0 -> r1 [label="west"];
+  r1 -> nowhere [label="down"];
+  r1 -> r0 [label="west"];
+  nowhere [label="?", shape=circle];
+}
+`
+	if b.String() != expected {
+		t.Errorf("Got: %s Expected: %s", b.String(), expected)
+	}
+}
+
+func TestMachinePlayer(t *testing.T) {
+	// prompts, then echoes a line, forever
+	program, err := synacor.Assemble(`
+		loop: set r0 msg
+		print: rmem r1 r0; jf r1 read; out r1; add r0 r0 1; jmp print
+		read: in r2; out r2; eq r3 r2 '\n'; jf r3 read; jmp loop
+		msg: data 'W' 'h' 'a' 't' ' ' 'd' 'o' ' ' 'y' 'o' 'u' ' ' 'd' 'o' '?' '\n' 0`, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	m.SetMemory(uint16(len(program)-1), 0)
+	for a, v := range program {
+		m.SetMemory(uint16(a), v)
+	}
+
+	play := machinePlayer(m, synacor.Harness{MaxSteps: 10000}, []string{"setup"}, nil)
+	outcomes := play([][]string{{}, {"a", "b"}})
+
+	expected := []outcome{{text: "\nsetup\n"}, {text: "\nb\n"}}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Errorf("Got: %+v Expected: %+v", outcomes, expected)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+// machinePlayer plays paths on clones of m, each after the setup commands,
+// telling rooms apart by the current room in memory when there's a game to
+// read it from.
+func machinePlayer(m synacor.Machine, h synacor.Harness, setup []string, game *synacor.Layout) player {
+	return func(paths [][]string) []outcome {
+		variants := make([]synacor.Variant, len(paths))
+		for i, p := range paths {
+			commands := append(append([]string(nil), setup...), p...)
+			if len(commands) > 0 {
+				variants[i].Input = strings.Join(commands, "\n") + "\n"
+			}
+		}
+
+		outcomes := make([]outcome, len(paths))
+		for _, r := range h.Run(m, variants) {
+			// the game prompts after every command; the response to the last
+			// one is between the last two prompts, or after the last prompt
+			// if the game ended instead of asking for more
+			responses := strings.Split(r.Output, prompt)
+			o := outcome{ended: r.Stop != synacor.InputExhausted}
+			if o.ended || len(responses) < 2 {
+				o.text = responses[len(responses)-1]
+			} else {
+				o.text = responses[len(responses)-2]
+			}
+
+			if game != nil {
+				g := synacor.NewGame(r.Machine, *game)
+				if room, err := g.CurrentRoom(); err == nil {
+					o.key = strconv.Itoa(int(room.Address))
+				}
+			}
+			outcomes[r.Index] = o
+		}
+		return outcomes
+	}
+}
+
+// stdout is stdout as a file that isn't closed when it's done with.
+type stdout struct{ io.Writer }
+
+func (stdout) Close() error { return nil }
+
+// create opens a file to write to, or stdout for "-".
+func create(file string) (io.WriteCloser, error) {
+	if file == "-" {
+		return stdout{os.Stdout}, nil
+	}
+	return os.Create(filepath.Clean(file))
+}
+
+func main() {
+	bin := flag.String("bin", "./challenge.bin", "binary or container to explore")
+	setupFile := flag.String("setup", "", "file with commands to run before exploring, one per line")
+	layoutFile := flag.String("layout", "", "layout of the game in memory, to tell rooms that read the same apart")
+	max := flag.Int("max-rooms", 500, "stop after finding this many rooms")
+	steps := flag.Uint64("steps", 50000000, "instructions each replay may run (0 is no limit)")
+	workers := flag.Int("workers", 0, "replays to run at once (default number of CPUs)")
+	jsonFile := flag.String("json", "map.json", "file to write the map to as JSON, - for stdout")
+	dotFile := flag.String("dot", "map.dot", "file to write the map to as a Graphviz graph, - for stdout")
+	flag.Parse()
+
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	if err := m.Load(*bin); err != nil {
+		panic(err)
+	}
+
+	setup := []string{}
+	if *setupFile != "" {
+		b, err := ioutil.ReadFile(filepath.Clean(*setupFile))
+		if err != nil {
+			panic(err)
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				setup = append(setup, line)
+			}
+		}
+	}
+
+	var layout *synacor.Layout
+	if *layoutFile != "" {
+		l, err := synacor.LoadLayout(*layoutFile)
+		if err != nil {
+			panic(err)
+		}
+		layout = &l
+	}
+
+	h := synacor.Harness{Workers: *workers, MaxSteps: *steps}
+	rooms, err := explore(machinePlayer(m, h, setup, layout), *max)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Found %d rooms\n", len(rooms))
+
+	outputs := []struct {
+		file  string
+		write func(io.Writer, []*room) error
+	}{
+		{*jsonFile, writeJSON},
+		{*dotFile, writeDOT},
+	}
+	for _, o := range outputs {
+		w, err := create(o.file)
+		if err != nil {
+			panic(err)
+		}
+		if err := o.write(w, rooms); err != nil {
+			panic(err)
+		}
+		if err := w.Close(); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pladdy/synacor"
+)
+
+func readDump(file string) ([]uint16, error) {
+	c, err := synacor.LoadProgram(file)
+	return c.Image, err
+}
+
+func main() {
+	symbolsFile := flag.String("symbols", "", "symbols file naming addresses")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: memdiff [-symbols file] <before.bin> <after.bin>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var symbols *synacor.Symbols
+	if *symbolsFile != "" {
+		var err error
+		if symbols, err = synacor.LoadSymbols(*symbolsFile); err != nil {
+			panic(err)
+		}
+	}
+
+	before, err := readDump(flag.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	after, err := readDump(flag.Arg(1))
+	if err != nil {
+		panic(err)
+	}
+
+	if err := synacor.WriteDiff(os.Stdout, before, after, symbols); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pladdy/synacor"
+)
+
+// readBinary reads a raw image or a container, returning true if it's a
+// container.
+func readBinary(file string) (synacor.Container, bool, error) {
+	data, err := ioutil.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return synacor.Container{}, false, err
+	}
+
+	c, err := synacor.ReadProgram(bytes.NewReader(data))
+	return c, synacor.IsContainer(data), err
+}
+
+func main() {
+	symbolsFile := flag.String("symbols", "", "symbols file naming addresses")
+	output := flag.String("o", "patched.bin", "file to write the patched binary to")
+	title := flag.String("title", "", "write a container with this title, describing the patched binary")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: patch [-symbols file] [-o patched.bin] [-title title] <binary> <patch file>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	program, wrapped, err := readBinary(flag.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	original := program.Image
+
+	symbols := program.Symbols
+	if *symbolsFile != "" {
+		if symbols, err = synacor.LoadSymbols(*symbolsFile); err != nil {
+			panic(err)
+		}
+	}
+
+	src, err := ioutil.ReadFile(filepath.Clean(flag.Arg(1)))
+	if err != nil {
+		panic(err)
+	}
+
+	patches, err := synacor.ParsePatches(string(src), original, symbols)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Bad patch:", err)
+		os.Exit(1)
+	}
+
+	patched, err := synacor.ApplyPatches(original, patches)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Bad patch:", err)
+		os.Exit(1)
+	}
+
+	fh, err := os.Create(filepath.Clean(*output))
+	if err != nil {
+		panic(err)
+	}
+
+	// a patched container stays a container, with the same metadata
+	if wrapped || *title != "" {
+		program.Image = patched
+		program.Symbols = symbols
+		if *title != "" {
+			program.Title = *title
+		}
+		err = program.Write(fh)
+	} else {
+		err = binary.Write(fh, binary.LittleEndian, patched)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if err := fh.Close(); err != nil {
+		panic(err)
+	}
+
+	if err := synacor.WriteDiff(os.Stdout, original, patched, symbols); err != nil {
+		panic(err)
+	}
+}
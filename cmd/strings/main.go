@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pladdy/synacor"
+)
+
+// How much of a string goes in the comment of its symbol.
+const commentLength = 40
+
+func main() {
+	bin := flag.String("bin", "./challenge.bin", "binary to decode")
+	steps := flag.Uint64("steps", 10000000, "instructions to run while the program decodes itself (0 is no limit)")
+	min := flag.Int("min", 4, "shortest string to report")
+	image := flag.String("o", "", "file to write the decoded memory image to")
+	symbols := flag.String("symbols", "", "file to write the strings to as symbols")
+	flag.Parse()
+
+	// the program decodes most of itself while starting up; run it in a
+	// sandbox until it asks for input.  Text it only decodes as it prints,
+	// each string with its own key, stays encoded.
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	m.SetOutput(ioutil.Discard)
+	if err := m.Load(*bin); err != nil {
+		panic(err)
+	}
+
+	stop := m.RunUntilInput(*steps)
+	fmt.Fprintf(os.Stderr, "Stopped after %d steps: %s\n", m.Steps(), stop)
+
+	if *image != "" {
+		fh, err := os.Create(filepath.Clean(*image))
+		if err != nil {
+			panic(err)
+		}
+		if err := m.WriteImage(fh); err != nil {
+			panic(err)
+		}
+		if err := fh.Close(); err != nil {
+			panic(err)
+		}
+	}
+
+	found := synacor.FindStrings(m.Image(), *min)
+	s := synacor.NewSymbols()
+
+	for _, f := range found {
+		kind := "nul"
+		if f.Prefixed {
+			kind = "len"
+		}
+		fmt.Printf("%d\t%s\t%q\n", f.Address, kind, f.Text)
+
+		comment := f.Text
+		if len(comment) > commentLength {
+			comment = comment[:commentLength] + "..."
+		}
+		s.Add(synacor.Symbol{
+			Address: f.Address,
+			Type:    synacor.String,
+			Name:    fmt.Sprintf("str_%d", f.Address),
+			Comment: fmt.Sprintf("%q", comment),
+		})
+	}
+
+	if *symbols != "" {
+		fh, err := os.Create(filepath.Clean(*symbols))
+		if err != nil {
+			panic(err)
+		}
+		if err := s.Write(fh); err != nil {
+			panic(err)
+		}
+		if err := fh.Close(); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pladdy/synacor"
+)
+
+func main() {
+	symbolsFile := flag.String("symbols", "", "symbols file naming addresses in comments")
+	out := flag.String("o", "compiled/main.go", "Go file to write; build the directory it's in")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: syn2go [-symbols file] [-o main.go] <binary or container>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := synacor.LoadProgram(flag.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+
+	symbols := c.Symbols
+	if *symbolsFile != "" {
+		if symbols, err = synacor.LoadSymbols(*symbolsFile); err != nil {
+			panic(err)
+		}
+	}
+
+	src, err := translate(c, symbols, filepath.Base(flag.Arg(0)))
+	if err != nil {
+		panic(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*out), 0750); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(*out, src, 0600); err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s; run it with go run ./%s\n", *out, filepath.Dir(*out))
+}
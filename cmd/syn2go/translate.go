@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+const registerStart = 32768
+
+// block is instructions run one after another, only ever entered at the first.
+type block struct {
+	start        uint16
+	instructions []synacor.Instruction
+}
+
+func (b block) end() uint16 {
+	last := b.instructions[len(b.instructions)-1]
+	return last.Address + uint16(last.Size())
+}
+
+// native returns true if an instruction can be translated: out is left to the
+// interpreter along with what isn't Compilable.
+func native(i synacor.Instruction) bool {
+	return i.Compilable() && i.Name != "out"
+}
+
+// findBlocks splits a program into basic blocks, decoding it from the start.
+// Blocks start at the entry point, at literal jump targets and after anything
+// that ends a block or isn't translated.  Code that's jumped into the middle
+// of a block is left to the interpreter.
+func findBlocks(image []uint16, entry uint16) []block {
+	instructions := synacor.Disassemble(image)
+
+	leaders := map[uint16]bool{entry: true}
+	for _, i := range instructions {
+		if t, ok := i.Target(); ok {
+			leaders[t] = true
+		}
+		if i.EndsBlock() || !native(i) {
+			leaders[i.Address+uint16(i.Size())] = true
+		}
+	}
+
+	blocks := []block{}
+	var current *block
+	for _, i := range instructions {
+		if !native(i) {
+			current = nil
+			continue
+		}
+		if current == nil || leaders[i.Address] {
+			blocks = append(blocks, block{start: i.Address})
+			current = &blocks[len(blocks)-1]
+		}
+		current.instructions = append(current.instructions, i)
+		if i.EndsBlock() {
+			current = nil
+		}
+	}
+	return blocks
+}
+
+// translate turns a program into the source of a Go program that runs it,
+// with its blocks as Go functions.
+func translate(c synacor.Container, symbols *synacor.Symbols, name string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `// Code generated by cmd/syn2go from %s; DO NOT EDIT.
+
+// Command %s runs %s with its basic blocks translated to Go, and the
+// interpreter for the rest.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pladdy/synacor"
+)
+
+func main() {
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	m.LoadContainer(synacor.Container{
+		Entry:     %d,
+		Registers: [8]uint16%s,
+		Stack:     []uint16%s,
+		Image:     image,
+	})
+	m.RunBlocks(blocks)
+	if f := m.Fault(); f != nil {
+		fmt.Fprintln(os.Stderr, f)
+		os.Exit(1)
+	}
+}
+
+// b is 1 for true and 0 for false.
+func b(c bool) uint16 {
+	if c {
+		return 1
+	}
+	return 0
+}
+
+// pop pops into a register, like pop, returning false if it would fault.
+func pop(rt *synacor.Runtime, register *uint16) bool {
+	v, ok := rt.Pop()
+	if ok {
+		*register = v
+	}
+	return ok
+}
+
+// rmem reads memory into a register, like rmem, returning false if it would
+// fault.
+func rmem(rt *synacor.Runtime, register *uint16, address uint16) bool {
+	v := rt.Read(address)
+	if v >= 32768 {
+		return false
+	}
+	*register = v
+	return true
+}
+`, name, strings.TrimSuffix(name, filepath.Ext(name)), name, c.Entry, list(c.Registers[:]), list(c.Stack))
+
+	blocks := findBlocks(c.Image, c.Entry)
+
+	b.WriteString("\nvar blocks = map[uint16]synacor.Block{\n")
+	for _, bl := range blocks {
+		fmt.Fprintf(&b, "%d: {Code: %s, Run: block%d},\n", bl.start, words(c.Image[bl.start:bl.end()]), bl.start)
+	}
+	b.WriteString("}\n")
+
+	for _, bl := range blocks {
+		writeBlock(&b, bl, symbols)
+	}
+
+	fmt.Fprintf(&b, "\nvar image = %s\n", words(c.Image))
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the Go: %v", err)
+	}
+	return src, nil
+}
+
+// list formats words on one line, in braces.
+func list(ws []uint16) string {
+	s := []string{}
+	for _, w := range ws {
+		s = append(s, fmt.Sprint(w))
+	}
+	return "{" + strings.Join(s, ", ") + "}"
+}
+
+// words formats a slice of words, 16 to a line.
+func words(ws []uint16) string {
+	if len(ws) <= 16 {
+		return "[]uint16" + list(ws)
+	}
+
+	var b strings.Builder
+	b.WriteString("[]uint16{")
+	for n, w := range ws {
+		if n%16 == 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d, ", w)
+	}
+	b.WriteString("\n}")
+	return b.String()
+}
+
+// writeBlock writes a block's function, which returns the address to carry on
+// from and how many instructions it ran.
+func writeBlock(b *bytes.Buffer, bl block, symbols *synacor.Symbols) {
+	fmt.Fprintf(b, "\n// block%d runs from %s.\n", bl.start, symbols.Name(bl.start))
+	fmt.Fprintf(b, "func block%d(rt *synacor.Runtime) (uint16, int) {\n", bl.start)
+	if usesRegisters(bl) {
+		b.WriteString("r := rt.R\n")
+	}
+
+	for n, i := range bl.instructions {
+		fmt.Fprintf(b, "// %s: %s\n", symbols.Name(i.Address), i.Format(symbols))
+		writeInstruction(b, i, n)
+	}
+
+	last := bl.instructions[len(bl.instructions)-1]
+	if last.Name != "jmp" && last.Name != "call" && last.Name != "ret" {
+		fmt.Fprintf(b, "return %d, %d\n", bl.end(), len(bl.instructions))
+	}
+	b.WriteString("}\n")
+}
+
+// writeInstruction writes the Go for an instruction, the nth in its block.
+// Returning the instruction's own address leaves it to the interpreter.
+func writeInstruction(b *bytes.Buffer, i synacor.Instruction, n int) {
+	args := make([]string, len(i.Args))
+	for k, a := range i.Args {
+		args[k] = operand(a)
+	}
+	bail := fmt.Sprintf("return %d, %d", i.Address, n)
+
+	switch i.Name {
+	case "set":
+		fmt.Fprintf(b, "%s = %s\n", args[0], args[1])
+	case "add":
+		fmt.Fprintf(b, "%s = (%s + %s) %% 32768\n", args[0], args[1], args[2])
+	case "mult":
+		fmt.Fprintf(b, "%s = uint16(uint32(%s) * uint32(%s) %% 32768)\n", args[0], args[1], args[2])
+	case "mod":
+		if i.Args[2] >= registerStart {
+			fmt.Fprintf(b, "if %s == 0 {\n%s\n}\n", args[2], bail)
+		}
+		fmt.Fprintf(b, "%s = %s %% %s\n", args[0], args[1], args[2])
+	case "eq":
+		fmt.Fprintf(b, "%s = b(%s == %s)\n", args[0], args[1], args[2])
+	case "gt":
+		fmt.Fprintf(b, "%s = b(%s > %s)\n", args[0], args[1], args[2])
+	case "and":
+		fmt.Fprintf(b, "%s = %s & %s\n", args[0], args[1], args[2])
+	case "or":
+		fmt.Fprintf(b, "%s = %s | %s\n", args[0], args[1], args[2])
+	case "not":
+		fmt.Fprintf(b, "%s = ^%s & 32767\n", args[0], args[1])
+	case "rmem":
+		fmt.Fprintf(b, "if !rmem(rt, &%s, %s) {\n%s\n}\n", args[0], args[1], bail)
+	case "wmem":
+		fmt.Fprintf(b, "rt.Write(%s, %s)\n", args[0], args[1])
+	case "push":
+		fmt.Fprintf(b, "if !rt.Push(%s) {\n%s\n}\n", args[0], bail)
+	case "pop":
+		fmt.Fprintf(b, "if !pop(rt, &%s) {\n%s\n}\n", args[0], bail)
+	case "jmp":
+		fmt.Fprintf(b, "return %s, %d\n", args[0], n+1)
+	case "jt":
+		fmt.Fprintf(b, "if %s != 0 {\nreturn %s, %d\n}\n", args[0], args[1], n+1)
+	case "jf":
+		fmt.Fprintf(b, "if %s == 0 {\nreturn %s, %d\n}\n", args[0], args[1], n+1)
+	case "call":
+		fmt.Fprintf(b, "if !rt.Call(%d, %s) {\n%s\n}\nreturn %s, %d\n", i.Address, args[0], bail, args[0], n+1)
+	case "ret":
+		fmt.Fprintf(b, "if a, ok := rt.Ret(); ok {\nreturn a, %d\n}\n%s\n", n+1, bail)
+	}
+}
+
+func usesRegisters(bl block) bool {
+	for _, i := range bl.instructions {
+		for _, a := range i.Args {
+			if a >= registerStart {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// operand is the Go for an operand: a register or a number.
+func operand(a uint16) string {
+	if a >= registerStart {
+		return fmt.Sprintf("r[%d]", a-registerStart)
+	}
+	return fmt.Sprint(a)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pladdy/synacor"
+)
+
+// bits prints r0 as 15 binary digits and a newline.
+const bits = `
+bits:	push r1
+	push r2
+	set r2 masks
+next:	rmem r1 r2
+	jf r1 done
+	and r1 r1 r0
+	gt r1 r1 0
+	add r1 r1 '0'
+	out r1
+	add r2 r2 1
+	jmp next
+done:	out '\n'
+	pop r2
+	pop r1
+	ret
+masks:	data 16384 8192 4096 2048 1024 512 256 128 64 32 16 8 4 2 1 0`
+
+var translateCases = []struct {
+	name  string
+	src   string
+	input string
+}{
+	{
+		name: "arithmetic",
+		src: `	add r0 32758 15; call bits
+		mult r0 32767 32767; call bits
+		set r3 200; mult r0 r3 r3; call bits
+		mod r0 32767 10; call bits
+		not r0 21845; call bits
+		and r0 12 10; call bits
+		or r0 12 10; call bits
+		eq r0 r3 200; call bits
+		gt r0 r3 r3; call bits
+		halt` + bits,
+	},
+	{
+		name: "input reversed",
+		src: `	set r1 0
+		read: in r0
+		eq r2 r0 '\n'
+		jt r2 write
+		push r0
+		add r1 r1 1
+		jmp read
+		write: jf r1 end
+		pop r0
+		out r0
+		add r1 r1 32767
+		jmp write
+		end: out '\n'
+		halt`,
+		input: "stressed\n",
+	},
+	{
+		name: "self-modifying",
+		src: `	set r1 3
+		loop: add r0 r0 1
+		wmem loop+3 5
+		call bits
+		add r1 r1 32767
+		jt r1 loop
+		halt` + bits,
+	},
+	{
+		name: "computed jump into a block",
+		src: `	set r0 middle
+		jmp r0
+		set r0 1
+		middle: add r0 r0 1
+		call bits
+		halt` + bits,
+	},
+	{
+		name: "pop on an empty stack",
+		src:  "push 1; pop r0; call bits; pop r0; pop r1; halt" + bits,
+	},
+	{
+		name: "mod by zero",
+		src:  "set r0 5; mod r1 r0 r2; halt",
+	},
+	{
+		name:  "input runs out",
+		src:   "in r0; out r0; jmp 0",
+		input: "ab",
+	},
+}
+
+// interpret runs a program with the interpreter, returning what it wrote to
+// stdout and stderr.
+func interpret(program []uint16, input string) (string, string) {
+	var out bytes.Buffer
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	m.SetOutput(&out)
+	m.SetInput(strings.NewReader(input))
+	m.LoadContainer(synacor.Container{Image: program})
+	m.RunSteps(0)
+
+	if f := m.Fault(); f != nil {
+		return out.String(), f.Error() + "\n"
+	}
+	return out.String(), ""
+}
+
+func TestTranslate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("needs the go command:", err)
+	}
+
+	// inside the module, so the programs can import the synacor package
+	dir, err := ioutil.TempDir(".", "_generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	programs := make([][]uint16, len(translateCases))
+	packages := []string{}
+	for n, c := range translateCases {
+		program, err := synacor.Assemble(c.src, 0, nil)
+		if err != nil {
+			t.Fatal("Got:", err, "For:", c.name)
+		}
+		programs[n] = program
+
+		src, err := translate(synacor.Container{Image: program}, nil, "test.bin")
+		if err != nil {
+			t.Fatal("Got:", err, "For:", c.name)
+		}
+		pkg := filepath.Join(dir, string(rune('a'+n)))
+		if err := os.Mkdir(pkg, 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pkg, "main.go"), src, 0600); err != nil {
+			t.Fatal(err)
+		}
+		packages = append(packages, "./"+pkg)
+	}
+
+	bin := filepath.Join(dir, "bin")
+	build := exec.Command("go", append([]string{"build", "-o", bin + string(filepath.Separator)}, packages...)...)
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatal("Got:", err, string(out))
+	}
+
+	for n, c := range translateCases {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(filepath.Join(bin, string(rune('a'+n))))
+		cmd.Stdin = strings.NewReader(c.input)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+
+		output, fault := interpret(programs[n], c.input)
+		if stdout.String() != output || stderr.String() != fault || (err != nil) != (fault != "") {
+			t.Errorf("Got: %q %q %v Expected: %q %q For: %s", stdout.String(), stderr.String(), err, output, fault, c.name)
+		}
+	}
+}
+
+func TestFindBlocks(t *testing.T) {
+	program, err := synacor.Assemble(`
+		set r0 1          # 0
+		loop: add r0 r0 1 # 3
+		out r0            # 7
+		gt r1 r0 5        # 9
+		jf r1 loop        # 13
+		call 21           # 16
+		halt              # 18
+		data 32800        # 19
+		noop              # 20
+		mod r0 r0 0       # 21
+		wmem 0 r0         # 25
+		ret               # 28`, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[uint16]int{0: 1, 3: 1, 9: 2, 16: 1, 20: 1, 25: 1, 28: 1}
+	blocks := findBlocks(program, 0)
+	starts := map[uint16]int{}
+	for _, b := range blocks {
+		starts[b.start] = len(b.instructions)
+	}
+	if len(starts) != len(expected) {
+		t.Error("Got:", starts, "Expected:", expected)
+	}
+	for start, n := range expected {
+		if starts[start] != n {
+			t.Error("Got:", starts, "Expected:", expected)
+			break
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+// Lines of input starting with this are commands for the VM, not the game.
+const commandPrefix = "!"
+
+const commandHelp = `VM commands:
+  !dump <raw|hex|dasm> <file>  write memory to a file
+  !snapshot <file>             write the VM's state to a container to load later
+  !bt                          show the calls the program is in
+  !print <expr>                show an expression's value
+  !set <r0-r7> <expr>          set a register
+  !break <addr> [if <expr>]    stop at an address, if an expression's true
+  !watch <expr>                stop when an expression's value changes
+  !log <addr> <expr>, ... [if <expr>]
+                               show expressions' values at an address
+  !points                      list the breakpoints, watchpoints and log points
+  !delete <n>                  delete a point
+  !continue, !step             carry on running when stopped at a point
+  !room                        show the room you're in
+  !rooms                       list the rooms you can get to from here
+  !items                       list the items and where they are
+  !inv                         list the items you're carrying
+  !teleport <room>             go to a room, by address or name
+  !take <item>                 put an item in your inventory
+  !move <item> to <room>       put an item in a room
+  !help                        show this help
+
+Expressions use Go's operators on numbers, names from -symbols, r0 to r7, pc,
+steps, mem[<expr>], stack[<expr>] (counting from the top), top and depth.
+Addresses are expressions without spaces, like confirm_teleporter+22.
+
+The room and item commands need -layout.`
+
+type commands struct {
+	m   synacor.Machine
+	out io.Writer
+	// game is nil without a layout, and the game commands don't work
+	game     *synacor.Game
+	debugger *debugger
+}
+
+// handle runs a line of input if it's a command, returning false if it's not.
+func (c commands) handle(line string) bool {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, commandPrefix) {
+		return false
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, commandPrefix))
+	if len(fields) == 0 {
+		fields = []string{"help"}
+	}
+
+	var err error
+	switch fields[0] {
+	case "dump":
+		err = c.dump(fields[1:])
+	case "snapshot":
+		err = c.snapshot(fields[1:])
+	case "bt":
+		fmt.Fprintf(c.out, "At %s\n%s", c.m.Symbols().Name(uint16(c.m.PC())), c.m.Backtrace().Format(c.m.Symbols()))
+	case "print":
+		err = c.print(strings.Join(fields[1:], " "))
+	case "set":
+		err = c.set(fields[1:])
+	case "break", "watch", "log":
+		err = c.addPoint(fields[0], strings.Join(fields[1:], " "))
+	case "points":
+		c.debugger.list()
+	case "delete":
+		err = c.deletePoint(fields[1:])
+	case "continue", "c", "step", "s":
+		err = fmt.Errorf("!%s only works when stopped at a point", fields[0])
+	case "room", "rooms", "items", "inv", "teleport", "take", "move":
+		err = c.gameCommand(fields[0], fields[1:])
+	case "help":
+		fmt.Fprintln(c.out, commandHelp)
+	default:
+		err = fmt.Errorf("unknown command %q, try !help", fields[0])
+	}
+
+	if err != nil {
+		fmt.Fprintln(c.out, "Error:", err)
+	}
+	return true
+}
+
+func (c commands) dump(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: !dump <raw|hex|dasm> <file>")
+	}
+
+	f, err := synacor.ParseDumpFormat(args[0])
+	if err != nil {
+		return err
+	}
+
+	fh, err := os.Create(filepath.Clean(args[1]))
+	if err != nil {
+		return err
+	}
+	if err := c.m.Dump(fh, f); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Dumped memory at %d (step %d) to %s\n", c.m.PC(), c.m.Steps(), args[1])
+	return nil
+}
+
+func (c commands) snapshot(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: !snapshot <file>")
+	}
+
+	fh, err := os.Create(filepath.Clean(args[0]))
+	if err != nil {
+		return err
+	}
+	title := fmt.Sprintf("snapshot at step %d", c.m.Steps())
+	if err := c.m.Snapshot(title).Write(fh); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Snapshot at %d (step %d) written to %s\n", c.m.PC(), c.m.Steps(), args[0])
+	return nil
+}
+
+func (c commands) print(expression string) error {
+	e, err := synacor.ParseExpression(expression, c.m.Symbols())
+	if err != nil {
+		return err
+	}
+	v, err := e.Eval(c.m)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s = %d\n", e, v)
+	return nil
+}
+
+func (c commands) set(args []string) error {
+	if len(args) < 2 || len(args[0]) != 2 || args[0][0] != 'r' || args[0][1] < '0' || args[0][1] > '7' {
+		return fmt.Errorf("usage: !set <r0-r7> <expr>")
+	}
+	e, err := synacor.ParseExpression(strings.Join(args[1:], " "), c.m.Symbols())
+	if err != nil {
+		return err
+	}
+	v, err := e.Eval(c.m)
+	if err != nil {
+		return err
+	}
+	if v < 0 || v > 32767 {
+		return fmt.Errorf("%d doesn't fit in a register", v)
+	}
+
+	c.m.SetRegister(int(args[0][1]-'0'), uint16(v))
+	fmt.Fprintf(c.out, "%s = %d\n", args[0], v)
+	return nil
+}
+
+var pointKinds = map[string]pointKind{
+	"break": breakpoint,
+	"watch": watchpoint,
+	"log":   logpoint,
+}
+
+func (c commands) addPoint(name, args string) error {
+	if strings.TrimSpace(args) == "" {
+		return fmt.Errorf("usage: see !help for !%s", name)
+	}
+	p, err := c.debugger.add(pointKinds[name], args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, "Added", p)
+	return nil
+}
+
+func (c commands) deletePoint(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: !delete <n>")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad point number %q", args[0])
+	}
+	if err := c.debugger.remove(n); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, "Deleted point", n)
+	return nil
+}
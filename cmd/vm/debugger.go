@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+// What a point does when it's hit.
+type pointKind int
+
+const (
+	// breakpoints stop at an address if their condition's true
+	breakpoint pointKind = iota
+	// watchpoints stop when their expression's value changes
+	watchpoint
+	// log points write their expressions' values at an address if their
+	// condition's true, and carry on
+	logpoint
+)
+
+var pointKindNames = map[pointKind]string{
+	breakpoint: "Breakpoint",
+	watchpoint: "Watchpoint",
+	logpoint:   "Log point",
+}
+
+type point struct {
+	n       int
+	kind    pointKind
+	address uint16
+	// condition is nil for points that are always hit
+	condition *synacor.Expression
+	// values a log point writes, or the one a watchpoint watches
+	values []synacor.Expression
+
+	// a watchpoint's value when it was last checked, if it could be worked out
+	last  int
+	known bool
+}
+
+func (p *point) String() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "%s %d", pointKindNames[p.kind], p.n)
+	if p.kind != watchpoint {
+		fmt.Fprintf(&s, " at %d", p.address)
+	}
+	if len(p.values) > 0 {
+		names := []string{}
+		for _, v := range p.values {
+			names = append(names, v.String())
+		}
+		fmt.Fprintf(&s, ": %s", strings.Join(names, ", "))
+	}
+	if p.condition != nil {
+		fmt.Fprintf(&s, " if %s", p.condition)
+	}
+	return s.String()
+}
+
+// debugger checks points before each instruction, and stops for a debugging
+// prompt when one's hit.
+type debugger struct {
+	m   synacor.Machine
+	out io.Writer
+
+	points []*point
+	added  int
+	// step stops before the next instruction
+	step bool
+	// steps when the points were last checked, so resuming from a stop
+	// doesn't stop at the same instruction again
+	checked uint64
+	started bool
+}
+
+func newDebugger(m synacor.Machine, out io.Writer) *debugger {
+	return &debugger{m: m, out: out}
+}
+
+// add a point from a command's arguments:
+//
+//	breakpoint  <address> [if <condition>]
+//	watchpoint  <expression>
+//	logpoint    <address> <expression>[, <expression>...] [if <condition>]
+//
+// where addresses are expressions worked out when the point's added.
+func (d *debugger) add(kind pointKind, args string) (*point, error) {
+	p := &point{kind: kind}
+	symbols := d.m.Symbols()
+
+	if i := strings.Index(args, " if "); i >= 0 && kind != watchpoint {
+		c, err := synacor.ParseExpression(args[i+len(" if "):], symbols)
+		if err != nil {
+			return nil, err
+		}
+		p.condition = &c
+		args = args[:i]
+	}
+
+	if kind != watchpoint {
+		fields := strings.SplitN(strings.TrimSpace(args), " ", 2)
+		address, err := d.address(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		p.address = address
+		args = ""
+		if len(fields) == 2 {
+			args = fields[1]
+		}
+	}
+
+	if kind != breakpoint {
+		for _, value := range strings.Split(args, ",") {
+			e, err := synacor.ParseExpression(value, symbols)
+			if err != nil {
+				return nil, err
+			}
+			p.values = append(p.values, e)
+		}
+		if kind == watchpoint && len(p.values) != 1 {
+			return nil, fmt.Errorf("a watchpoint watches one expression")
+		}
+	} else if strings.TrimSpace(args) != "" {
+		return nil, fmt.Errorf("unexpected %q after the address, conditions start with if", strings.TrimSpace(args))
+	}
+
+	if kind == watchpoint {
+		p.last, p.known = d.watch(p)
+	}
+
+	d.added++
+	p.n = d.added
+	d.points = append(d.points, p)
+	return p, nil
+}
+
+// address works out an address like 6027 or confirm_teleporter+22.
+func (d *debugger) address(s string) (uint16, error) {
+	e, err := synacor.ParseExpression(s, d.m.Symbols())
+	if err != nil {
+		return 0, err
+	}
+	a, err := e.Eval(d.m)
+	if err != nil {
+		return 0, err
+	}
+	if a < 0 || a >= 1<<15 {
+		return 0, fmt.Errorf("%d isn't an address", a)
+	}
+	return uint16(a), nil
+}
+
+// remove the point numbered n.
+func (d *debugger) remove(n int) error {
+	for i, p := range d.points {
+		if p.n == n {
+			d.points = append(d.points[:i], d.points[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no point %d", n)
+}
+
+// check writes log points hit at the next instruction and returns why the
+// Machine should stop there, or "" if it shouldn't.
+func (d *debugger) check() string {
+	steps := d.m.Steps()
+	if d.started && steps == d.checked {
+		return ""
+	}
+	d.started, d.checked = true, steps
+
+	if d.step {
+		d.step = false
+		return "Stepped"
+	}
+
+	pc := uint16(d.m.PC())
+	stop := ""
+	for _, p := range d.points {
+		if p.kind == watchpoint {
+			last, known := p.last, p.known
+			p.last, p.known = d.watch(p)
+			if known && p.known && p.last != last && stop == "" {
+				stop = fmt.Sprintf("%s: %d -> %d", p, last, p.last)
+			}
+			continue
+		}
+		if p.address != pc {
+			continue
+		}
+
+		if p.condition != nil {
+			v, err := p.condition.Eval(d.m)
+			if err != nil && stop == "" {
+				// a condition that can't be worked out stops, to say so
+				stop = fmt.Sprintf("%s: %v", p, err)
+			}
+			if err != nil || v == 0 {
+				continue
+			}
+		}
+		if p.kind == logpoint {
+			d.log(p)
+		} else if stop == "" {
+			stop = p.String()
+		}
+	}
+	return stop
+}
+
+// watch returns a watchpoint's value, if it can be worked out.
+func (d *debugger) watch(p *point) (int, bool) {
+	v, err := p.values[0].Eval(d.m)
+	return v, err == nil
+}
+
+// log writes a log point's values.
+func (d *debugger) log(p *point) {
+	values := []string{}
+	for _, e := range p.values {
+		v, err := e.Eval(d.m)
+		if err != nil {
+			values = append(values, fmt.Sprintf("%s = (%v)", e, err))
+			continue
+		}
+		values = append(values, fmt.Sprintf("%s = %d", e, v))
+	}
+	fmt.Fprintf(d.out, "[log %d at %s, step %d] %s\n", p.n, d.m.Symbols().Name(p.address), d.m.Steps(), strings.Join(values, ", "))
+}
+
+// list writes the points.
+func (d *debugger) list() {
+	if len(d.points) == 0 {
+		fmt.Fprintln(d.out, "No points")
+	}
+	for _, p := range d.points {
+		fmt.Fprintln(d.out, p)
+	}
+}
+
+// stopped writes why the Machine stopped and where.
+func (d *debugger) stopped(reason string) {
+	i := d.m.Decode(uint16(d.m.PC()))
+	fmt.Fprintf(d.out, "%s\n%s: %s\n", reason, d.m.Symbols().Name(i.Address), i.Format(d.m.Symbols()))
+}
+
+// prompt reads debugging commands until one resumes the Machine, for when
+// the VM is played without the terminal UI.  Lines go to handle, apart from
+// !continue and !step.
+func (d *debugger) prompt(in *bufio.Reader, handle func(line string) bool) {
+	for {
+		fmt.Fprint(d.out, "(paused) ")
+		line, err := in.ReadString('\n')
+		switch strings.TrimSpace(line) {
+		case "!continue", "!c":
+			return
+		case "!step", "!s":
+			d.step = true
+			return
+		}
+		if err != nil {
+			// nothing left to read; carry on so piped input still finishes
+			fmt.Fprintln(d.out)
+			return
+		}
+		if !handle(line) && strings.TrimSpace(line) != "" {
+			fmt.Fprintln(d.out, "The game isn't waiting for input: !continue, !step or a VM command")
+		}
+	}
+}
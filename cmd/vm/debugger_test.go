@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pladdy/synacor"
+)
+
+// testCommands returns commands for a Machine counting r0 up to 5.
+func testCommands(t *testing.T, out *bytes.Buffer) commands {
+	program, err := synacor.Assemble(`
+		set r0 0        # 0
+		loop: add r0 r0 1  # 3
+		eq r1 r0 5      # 7
+		jf r1 loop      # 11
+		halt            # 14`, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	m.LoadContainer(synacor.Container{Image: program})
+	return commands{m: m, out: out, debugger: newDebugger(m, out)}
+}
+
+// runToPoint runs the Machine until a point stops it, returning why.
+func runToPoint(c commands) string {
+	for c.m.Stopped() == synacor.NotStopped {
+		if reason := c.debugger.check(); reason != "" {
+			return reason
+		}
+		c.m.Step()
+	}
+	return c.m.Stopped().String()
+}
+
+func TestDebuggerPoints(t *testing.T) {
+	var out bytes.Buffer
+	c := testCommands(t, &out)
+
+	for _, line := range []string{
+		"!log 3 r0, r0 * 2 if r0 > 2",
+		"!break 11 if r0 == 4",
+		"!watch r1",
+		"!break 14",
+	} {
+		c.handle(line)
+	}
+
+	tests := []struct {
+		stop string
+		pc   int
+	}{
+		{"Breakpoint 2 at 11 if r0 == 4", 11},
+		{"Watchpoint 3: r1: 0 -> 1", 11},
+		{"Breakpoint 4 at 14", 14},
+		{"halted", 14},
+	}
+
+	for _, test := range tests {
+		if stop := runToPoint(c); stop != test.stop || c.m.PC() != test.pc {
+			t.Error("Got:", stop, c.m.PC(), "Expected:", test.stop, test.pc)
+		}
+	}
+
+	logs := "[log 1 at 3, step 10] r0 = 3, r0 * 2 = 6\n[log 1 at 3, step 13] r0 = 4, r0 * 2 = 8\n"
+	if !strings.Contains(out.String(), logs) {
+		t.Errorf("Got: %q Expected: %q", out.String(), logs)
+	}
+}
+
+func TestDebuggerCommandErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"!break", "usage"},
+		{"!break 3 r0", "conditions start with if"},
+		{"!break 40000", "isn't an address"},
+		{"!break nowhere", "unknown name"},
+		{"!break 3 if r0 ==", "ends early"},
+		{"!watch r0, r1", "one expression"},
+		{"!log 3", "ends early"},
+		{"!delete 1", "no point 1"},
+		{"!delete one", "bad point number"},
+		{"!print top", "past the bottom of the stack"},
+		{"!continue", "only works when stopped"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		c := testCommands(t, &out)
+		c.handle(test.line)
+		if !strings.Contains(out.String(), test.want) {
+			t.Error("Got:", out.String(), "Expected:", test.want, "For:", test.line)
+		}
+	}
+}
+
+func TestDebuggerPrompt(t *testing.T) {
+	var out bytes.Buffer
+	c := testCommands(t, &out)
+	c.handle("!break 7")
+	c.handle("!delete 1")
+	c.handle("!break 3")
+
+	if stop := runToPoint(c); stop != "Breakpoint 2 at 3" {
+		t.Fatal("Got:", stop, "Expected:", "Breakpoint 2 at 3")
+	}
+	out.Reset()
+	c.debugger.prompt(bufio.NewReader(strings.NewReader("!print r0 + 1\nlook\n!step\n")), c.handle)
+
+	expected := "(paused) r0 + 1 = 1\n(paused) The game isn't waiting for input: !continue, !step or a VM command\n(paused) "
+	if out.String() != expected {
+		t.Errorf("Got: %q Expected: %q", out.String(), expected)
+	}
+
+	// resuming doesn't stop at the same breakpoint again, and !step stops at
+	// the next instruction
+	if stop := runToPoint(c); stop != "Stepped" || c.m.PC() != 7 {
+		t.Error("Got:", stop, c.m.PC(), "Expected:", "Stepped", 7)
+	}
+}
+
+func TestDebuggerSet(t *testing.T) {
+	var out bytes.Buffer
+	c := testCommands(t, &out)
+	c.handle("!break 3")
+
+	if stop := runToPoint(c); stop != "Breakpoint 1 at 3" {
+		t.Fatal("Got:", stop, "Expected:", "Breakpoint 1 at 3")
+	}
+	c.handle("!delete 1")
+	out.Reset()
+	c.handle("!set r0 2 * 2")
+
+	if out.String() != "r0 = 4\n" {
+		t.Errorf("Got: %q Expected: %q", out.String(), "r0 = 4\n")
+	}
+
+	// the loop carries on from 4, so it's done after one more add
+	if stop := runToPoint(c); stop != synacor.Halted.String() || c.m.Register(0) != 5 {
+		t.Error("Got:", stop, c.m.Register(0), "Expected:", synacor.Halted, 5)
+	}
+
+	for _, test := range []struct {
+		line string
+		want string
+	}{
+		{"!set r8 1", "usage"},
+		{"!set r0", "usage"},
+		{"!set r7 -1", "doesn't fit"},
+	} {
+		out.Reset()
+		c.handle(test.line)
+		if !strings.Contains(out.String(), test.want) {
+			t.Error("Got:", out.String(), "Expected:", test.want, "For:", test.line)
+		}
+	}
+}
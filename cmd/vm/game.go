@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+// gameCommand runs a command that reads or changes the game's rooms and items.
+func (c commands) gameCommand(name string, args []string) error {
+	if c.game == nil {
+		return fmt.Errorf("!%s needs the game's layout, run with -layout", name)
+	}
+
+	switch name {
+	case "room":
+		return c.room()
+	case "rooms":
+		return c.rooms()
+	case "items":
+		return c.items(false)
+	case "inv":
+		return c.items(true)
+	case "teleport":
+		return c.teleport(args)
+	case "take":
+		return c.take(args)
+	}
+	return c.move(args)
+}
+
+func (c commands) room() error {
+	r, err := c.game.CurrentRoom()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "%s (%d)\n  %s\n", r.Name, r.Address, strings.TrimSpace(r.Description))
+	for _, e := range r.Exits {
+		fmt.Fprintf(c.out, "  %s -> %s\n", e.Name, c.roomName(e.Room))
+	}
+	return nil
+}
+
+func (c commands) rooms() error {
+	rooms, err := c.game.Rooms()
+	for _, r := range rooms {
+		fmt.Fprintf(c.out, "%5d  %s\n", r.Address, r.Name)
+	}
+	return err
+}
+
+func (c commands) items(carried bool) error {
+	var items []synacor.Item
+	var err error
+	if carried {
+		items, err = c.game.Inventory()
+	} else {
+		items, err = c.game.Items()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, i := range items {
+		fmt.Fprintf(c.out, "%5d  %-20s %s\n", i.Address, i.Name, c.location(i))
+	}
+	return nil
+}
+
+func (c commands) teleport(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: !teleport <room>")
+	}
+
+	room, err := c.findRoom(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	if err := c.game.Teleport(room); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Teleported to %s, look around\n", c.roomName(room))
+	return nil
+}
+
+func (c commands) take(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: !take <item>")
+	}
+
+	item := strings.Join(args, " ")
+	if err := c.game.Take(item); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Took the %s\n", item)
+	return nil
+}
+
+func (c commands) move(args []string) error {
+	parts := strings.SplitN(strings.Join(args, " "), " to ", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("usage: !move <item> to <room>")
+	}
+
+	room, err := c.findRoom(parts[1])
+	if err != nil {
+		return err
+	}
+	if err := c.game.MoveItem(parts[0], room); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Moved the %s to %s\n", parts[0], c.roomName(room))
+	return nil
+}
+
+// findRoom returns the address of a room given as an address or the name of a
+// room that can be reached from here.
+func (c commands) findRoom(s string) (uint16, error) {
+	if address, err := strconv.ParseUint(s, 10, 15); err == nil {
+		return uint16(address), nil
+	}
+
+	rooms, err := c.game.Rooms()
+	if err != nil {
+		return 0, err
+	}
+
+	found := []synacor.Room{}
+	for _, r := range rooms {
+		if strings.EqualFold(r.Name, s) {
+			found = append(found, r)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return 0, fmt.Errorf("no room called %q that can be reached from here", s)
+	case 1:
+		return found[0].Address, nil
+	}
+
+	addresses := []string{}
+	for _, r := range found {
+		addresses = append(addresses, strconv.Itoa(int(r.Address)))
+	}
+	return 0, fmt.Errorf("%d rooms are called %q (%s), use an address", len(found), s, strings.Join(addresses, ", "))
+}
+
+// roomName returns a room's name and address.
+func (c commands) roomName(address uint16) string {
+	r, err := c.game.Room(address)
+	if err != nil {
+		return fmt.Sprintf("? (%d)", address)
+	}
+	return fmt.Sprintf("%s (%d)", r.Name, address)
+}
+
+// location describes where an item is.
+func (c commands) location(i synacor.Item) string {
+	if c.game.Carried(i) {
+		return "carried"
+	}
+	if _, err := c.game.Room(i.Location); err != nil {
+		return fmt.Sprintf("nowhere (%d)", i.Location)
+	}
+	return "in " + c.roomName(i.Location)
+}
@@ -1,9 +1,151 @@
 package main
 
-import "github.com/pladdy/synacor"
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pladdy/synacor"
+	"github.com/pladdy/synacor/remote"
+)
+
+// Address of the function the teleporter calls to check the eighth register.
+const confirmTeleporter = 6027
 
 func main() {
+	bin := flag.String("bin", "./challenge.bin", "binary or container to run")
+	codes := flag.String("codes", "", "file to write codes found in the game's output to")
+	symbols := flag.String("symbols", "", "symbols file naming addresses in the trace")
+	stackLimit := flag.Int("stack-limit", 0, "fault when the stack gets deeper than this (0 is no limit)")
+	layout := flag.String("layout", "", "layout of the game's rooms and items in memory, for the room and item commands")
+	ui := flag.Bool("tui", false, "play in a split-pane terminal UI showing the VM's state")
+	hookTeleporter := flag.Bool("hook-teleporter", false, "run the teleporter's confirmation natively, so it finishes with the right r7")
+	listen := flag.String("listen", "", "serve the VM for remote debugging on a TCP address or unix:<path> instead of playing")
+	checkpoints := flag.String("checkpoints", "", "file to write checkpoints of the VM's state to, for cmd/checkpoints to compare")
+	every := flag.Uint64("every", 10000, "instructions between checkpoints (0 is only at in and out)")
+	flag.Parse()
+
 	m := synacor.NewMachine()
-	m.Load("./challenge.bin")
+	if err := m.Load(*bin); err != nil {
+		panic(err)
+	}
+
+	if *symbols != "" {
+		s, err := synacor.LoadSymbols(*symbols)
+		if err != nil {
+			panic(err)
+		}
+		m.SetSymbols(s)
+	}
+
+	var codesFile *os.File
+	var watcher *synacor.CodeWatcher
+	if *codes != "" {
+		fh, err := os.Create(filepath.Clean(*codes))
+		if err != nil {
+			panic(err)
+		}
+		codesFile, watcher = fh, synacor.NewCodeWatcher(fh)
+		m.WatchCodes(watcher)
+		defer closeCodes(codesFile, watcher)
+	}
+
+	m.SetStackLimit(*stackLimit)
+
+	var logFile *os.File
+	var log *synacor.CheckpointLog
+	if *checkpoints != "" {
+		fh, err := os.Create(filepath.Clean(*checkpoints))
+		if err != nil {
+			panic(err)
+		}
+		logFile, log = fh, synacor.NewCheckpointLog(fh, *every)
+		m.SetCheckpointLog(log)
+		defer flush(logFile, log)
+	}
+
+	if *hookTeleporter {
+		m.SetHook(confirmTeleporter, synacor.ConfirmTeleporter)
+	}
+
+	var game *synacor.Game
+	if *layout != "" {
+		l, err := synacor.LoadLayout(*layout)
+		if err != nil {
+			panic(err)
+		}
+		g := synacor.NewGame(m, l)
+		game = &g
+	}
+
+	if *listen != "" {
+		l, err := remote.Listen(*listen)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintln(os.Stderr, "Debugging on", l.Addr())
+		if err := remote.NewServer(m).Serve(l); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if *ui {
+		if err := newTUI(m, game).run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// the debugging prompt reads from the same reader as the game, so neither
+	// loses what the other has buffered
+	in := bufio.NewReader(os.Stdin)
+	m.SetInput(in)
+
+	d := newDebugger(m, os.Stdout)
+	c := commands{m: m, out: os.Stdout, game: game, debugger: d}
+	m.SetCommands(c.handle)
+	m.SetDebugger(func() {
+		if reason := d.check(); reason != "" {
+			d.stopped(reason)
+			d.prompt(in, c.handle)
+		}
+	})
 	m.Run()
+
+	if f := m.Fault(); f != nil {
+		fmt.Fprintln(os.Stderr, f)
+		if log != nil {
+			flush(logFile, log)
+		}
+		if codesFile != nil {
+			closeCodes(codesFile, watcher)
+		}
+		os.Exit(1)
+	}
+}
+
+// closeCodes closes the file codes are written to.
+func closeCodes(fh *os.File, w *synacor.CodeWatcher) {
+	err := w.Err()
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Writing codes:", err)
+	}
+}
+
+// flush writes what's left of a checkpoint log and closes its file.
+func flush(fh *os.File, log *synacor.CheckpointLog) {
+	err := log.Flush()
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Writing checkpoints:", err)
+	}
 }
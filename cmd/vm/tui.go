@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+// Keys the terminal UI responds to; the terminal is in raw mode so control
+// keys come through as their control characters.
+const (
+	keyQuit      = 3  // ctrl-c
+	keyRedraw    = 12 // ctrl-l
+	keyStep      = 14 // ctrl-n
+	keyPause     = 16 // ctrl-p
+	keySnapshot  = 19 // ctrl-s
+	keyEnter     = '\r'
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+// ANSI escape sequences.
+const (
+	enterScreen = "\x1b[?1049h"
+	leaveScreen = "\x1b[?1049l"
+	clearLine   = "\x1b[K"
+)
+
+const (
+	// width of the VM state panel
+	panelWidth = 24
+	// instructions run between redraws
+	tuiBatch = 20000
+	// lines of game output kept
+	transcriptLines = 1000
+)
+
+// transcript is the game's output, split into lines.
+type transcript struct {
+	lines []string
+	// the last line, until its newline is written
+	partial string
+}
+
+func (t *transcript) Write(p []byte) (int, error) {
+	parts := strings.Split(t.partial+string(p), "\n")
+	t.lines = append(t.lines, parts[:len(parts)-1]...)
+	t.partial = parts[len(parts)-1]
+
+	if len(t.lines) > transcriptLines {
+		t.lines = t.lines[len(t.lines)-transcriptLines:]
+	}
+	return len(p), nil
+}
+
+// last returns the last n lines wrapped to width.
+func (t *transcript) last(n, width int) []string {
+	wrapped := []string{}
+	lines := append(t.lines, t.partial)
+	for i := len(lines) - 1; i >= 0 && len(wrapped) < n; i-- {
+		wrapped = append(wrap(lines[i], width), wrapped...)
+	}
+	if len(wrapped) > n {
+		wrapped = wrapped[len(wrapped)-n:]
+	}
+	return wrapped
+}
+
+// wrap breaks a line into pieces no wider than width.
+func wrap(line string, width int) []string {
+	runes := []rune(strings.TrimRight(line, "\r"))
+	pieces := []string{}
+	for len(runes) > width {
+		pieces = append(pieces, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(pieces, string(runes))
+}
+
+// pad cuts or pads s with spaces to exactly width characters.
+func pad(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
+
+// tui runs the game in a split-pane terminal UI: the transcript and a command
+// line on the left, the VM's state on the right.
+type tui struct {
+	m          synacor.Machine
+	transcript *transcript
+	commands   commands
+
+	// the line being typed
+	input []rune
+	// lines typed while the game wasn't waiting for input
+	pending []string
+	paused  bool
+	waiting bool
+	// bytes of an escape sequence left to skip
+	escape int
+
+	height, width int
+}
+
+func newTUI(m synacor.Machine, game *synacor.Game) *tui {
+	t := &transcript{}
+	m.SetOutput(t)
+	m.SetTrace(nil)
+	c := commands{m: m, out: t, game: game, debugger: newDebugger(m, t)}
+	return &tui{m: m, transcript: t, commands: c, height: 24, width: 80}
+}
+
+// run the game until it's quit with ctrl-c.
+func (t *tui) run() error {
+	state, err := stty("-g")
+	if err != nil {
+		return fmt.Errorf("the terminal UI needs a terminal: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return err
+	}
+	defer stty(strings.TrimSpace(state))
+
+	fmt.Print(enterScreen)
+	defer fmt.Print(leaveScreen)
+	t.resize()
+
+	keys := make(chan byte)
+	go func() {
+		b := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(b); err != nil {
+				close(keys)
+				return
+			}
+			keys <- b[0]
+		}
+	}()
+
+	for {
+		fmt.Print(t.frame())
+
+		var k byte
+		var ok bool
+		if t.running() {
+			t.runBatch()
+			t.feed()
+			select {
+			case k, ok = <-keys:
+			default:
+				continue
+			}
+		} else {
+			k, ok = <-keys
+		}
+
+		if !ok || !t.key(k) {
+			return nil
+		}
+	}
+}
+
+// runBatch runs up to tuiBatch instructions, until the game waits for input or
+// a point stops it.
+func (t *tui) runBatch() {
+	d := t.commands.debugger
+	for n := 0; n < tuiBatch && t.m.Stopped() == synacor.NotStopped; n++ {
+		if t.m.WaitingForInput() {
+			t.waiting = true
+			return
+		}
+		if reason := d.check(); reason != "" {
+			d.stopped(reason)
+			t.paused = true
+			return
+		}
+		t.m.Step()
+	}
+}
+
+// running returns true if the game can run without anything from the player.
+func (t *tui) running() bool {
+	return !t.paused && !t.waiting && t.m.Stopped() == synacor.NotStopped
+}
+
+// key handles a key press, returning false to quit.
+func (t *tui) key(k byte) bool {
+	if t.escape > 0 {
+		t.escape--
+		return true
+	}
+
+	switch k {
+	case keyQuit:
+		return false
+	case keyPause:
+		t.paused = !t.paused
+	case keyStep:
+		t.step()
+	case keySnapshot:
+		t.snapshot()
+	case keyRedraw:
+		t.resize()
+	case keyEnter:
+		t.submit()
+	case keyBackspace, keyCtrlH:
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+	case keyEscape:
+		// arrow keys and the like: ESC [ <key>
+		t.escape = 2
+	default:
+		if k >= ' ' && k <= '~' {
+			t.input = append(t.input, rune(k))
+		}
+	}
+	return true
+}
+
+// snapshot writes the VM's state to snapshot-<step>.syn; the transcript says
+// where, or why it couldn't.
+func (t *tui) snapshot() {
+	file := fmt.Sprintf("snapshot-%d.syn", t.m.Steps())
+	if err := t.commands.snapshot([]string{file}); err != nil {
+		fmt.Fprintln(t.transcript, "Snapshot failed:", err)
+	}
+}
+
+// step executes one instruction while paused.
+func (t *tui) step() {
+	if !t.paused {
+		fmt.Fprintln(t.transcript, "Pause (ctrl-p) before stepping")
+		return
+	}
+	t.waiting = t.m.RunUntilInput(1) == synacor.WaitingForInput
+	t.feed()
+}
+
+// submit sends the line typed to the game, or runs it if it's a VM command.
+func (t *tui) submit() {
+	line := string(t.input)
+	t.input = nil
+	fmt.Fprintln(t.transcript, line)
+
+	if t.commands.handle(line) {
+		return
+	}
+	t.pending = append(t.pending, line+"\n")
+	t.feed()
+}
+
+// feed gives the game the next line typed if it's waiting for one, and runs
+// the in instruction that was waiting so it reads the line.
+func (t *tui) feed() {
+	if t.waiting && len(t.pending) > 0 {
+		t.m.SetInput(strings.NewReader(t.pending[0]))
+		t.pending = t.pending[1:]
+		t.waiting = false
+		t.m.Step()
+	}
+}
+
+// state describes what the game is doing.
+func (t *tui) state() string {
+	switch {
+	case t.m.Stopped() != synacor.NotStopped:
+		return t.m.Stopped().String()
+	case t.paused:
+		return "paused"
+	case t.waiting:
+		return "waiting for input"
+	}
+	return "running"
+}
+
+// panel returns the lines of the VM state panel.
+func (t *tui) panel() []string {
+	pc := t.m.PC()
+	lines := []string{
+		fmt.Sprintf("state %s", t.state()),
+		fmt.Sprintf("pc    %d", pc),
+		fmt.Sprintf("func  %s", t.m.Symbols().Name(uint16(pc))),
+		fmt.Sprintf("steps %d", t.m.Steps()),
+		"",
+	}
+
+	for n := 0; n < 8; n += 2 {
+		lines = append(lines, fmt.Sprintf("r%d %-5d  r%d %-5d", n, t.m.Register(n), n+1, t.m.Register(n+1)))
+	}
+
+	stack := *t.m.Stack
+	lines = append(lines, "", fmt.Sprintf("stack %d deep", len(stack)))
+	for i := len(stack) - 1; i >= 0 && i >= len(stack)-6; i-- {
+		lines = append(lines, fmt.Sprintf("  %s", t.m.Symbols().Name(stack[i])))
+	}
+
+	if f := t.m.Fault(); f != nil {
+		lines = append(lines, "", f.Reason)
+	}
+
+	return append(lines, "",
+		"^P pause   ^N step",
+		"^S snapshot",
+		"^L redraw  ^C quit")
+}
+
+// frame returns what to write to the terminal to draw the UI.
+func (t *tui) frame() string {
+	var b strings.Builder
+	left := t.width - panelWidth - 1
+	rows := t.height - 1
+
+	transcript := t.transcript.last(rows, left)
+	panel := t.panel()
+
+	for row := 0; row < rows; row++ {
+		text, state := "", ""
+		if row < len(transcript) {
+			text = transcript[row]
+		}
+		if row < len(panel) {
+			state = panel[row]
+		}
+		fmt.Fprintf(&b, "\x1b[%d;1H%s|%s", row+1, pad(text, left), pad(" "+state, panelWidth))
+	}
+
+	// the end of the line being typed, if it's too long to fit
+	prompt := "> " + string(t.input)
+	if runes := []rune(prompt); len(runes) > t.width-1 {
+		prompt = string(runes[len(runes)-(t.width-1):])
+	}
+	fmt.Fprintf(&b, "\x1b[%d;1H%s%s", t.height, prompt, clearLine)
+	return b.String()
+}
+
+// resize fits the UI to the terminal.
+func (t *tui) resize() {
+	size, err := stty("size")
+	if err != nil {
+		return
+	}
+
+	fields := strings.Fields(size)
+	if len(fields) != 2 {
+		return
+	}
+	height, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return
+	}
+	width, err := strconv.Atoi(fields[1])
+	if err != nil || width < panelWidth+20 || height < 10 {
+		return
+	}
+	t.height, t.width = height, width
+	fmt.Print("\x1b[2J")
+}
+
+// stty runs stty on the terminal.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
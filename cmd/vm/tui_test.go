@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pladdy/synacor"
+)
+
+func TestTranscript(t *testing.T) {
+	tr := &transcript{}
+	tr.Write([]byte("a long line\nsh"))
+	tr.Write([]byte("ort\nWhat do"))
+
+	tests := []struct {
+		n, width int
+		expected []string
+	}{
+		{10, 80, []string{"a long line", "short", "What do"}},
+		{2, 80, []string{"short", "What do"}},
+		{10, 4, []string{"a lo", "ng l", "ine", "shor", "t", "What", " do"}},
+		{3, 4, []string{"t", "What", " do"}},
+	}
+
+	for _, test := range tests {
+		result := tr.last(test.n, test.width)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Got: %q Expected: %q", result, test.expected)
+		}
+	}
+}
+
+// testTUI returns a terminal UI running a program that reads a line and
+// echoes its first character.
+func testTUI(t *testing.T) *tui {
+	program := []uint16{20, 32768, 20, 32769, 19, 32768, 0}
+
+	dir, err := ioutil.TempDir("", "vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	file := filepath.Join(dir, "echo.bin")
+	fh, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.Write(fh, binary.LittleEndian, program)
+	fh.Close()
+
+	m := synacor.NewMachine()
+	if err := m.Load(file); err != nil {
+		t.Fatal(err)
+	}
+	return newTUI(m, nil)
+}
+
+func TestTUIInput(t *testing.T) {
+	ui := testTUI(t)
+
+	// typed before the game asks for it
+	for _, k := range []byte("xy\x7fz") {
+		ui.key(k)
+	}
+	ui.key(keyEnter)
+
+	ui.waiting = ui.m.RunUntilInput(100) == synacor.WaitingForInput
+	ui.feed()
+	ui.m.RunUntilInput(100)
+
+	if ui.m.Stopped() != synacor.Halted {
+		t.Error("Got:", ui.m.Stopped(), "Expected:", synacor.Halted)
+	}
+	if ui.m.Register(1) != 'z' {
+		t.Error("Got:", ui.m.Register(1), "Expected:", 'z')
+	}
+	expected := []string{"xz", "x"}
+	if result := ui.transcript.last(2, 80); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Got: %q Expected: %q", result, expected)
+	}
+}
+
+func TestTUIStep(t *testing.T) {
+	ui := testTUI(t)
+
+	ui.key(keyStep)
+	if ui.m.Steps() != 0 {
+		t.Error("Got:", ui.m.Steps(), "Expected:", 0)
+	}
+
+	ui.key(keyPause)
+	ui.key(keyStep)
+	if !ui.waiting || ui.state() != "paused" {
+		t.Error("Got:", ui.waiting, ui.state(), "Expected:", true, "paused")
+	}
+
+	for _, k := range []byte("ab\r") {
+		ui.key(k)
+	}
+	if ui.m.Steps() != 1 || ui.m.Register(0) != 'a' {
+		t.Error("Got:", ui.m.Steps(), ui.m.Register(0), "Expected:", 1, 'a')
+	}
+}
+
+func TestTUISnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "synacor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	ui := testTUI(t)
+	ui.key(keySnapshot)
+	if _, err := os.Stat("snapshot-0.syn"); err != nil {
+		t.Error("Got:", err, "Expected:", nil)
+	}
+	lines := ui.transcript.lines
+	if len(lines) == 0 || !strings.HasSuffix(lines[len(lines)-1], "written to snapshot-0.syn") {
+		t.Error("Got:", lines, "Expected:", "written to snapshot-0.syn")
+	}
+
+	// a snapshot that can't be written says so
+	if err := os.Remove("snapshot-0.syn"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("snapshot-0.syn", 0700); err != nil {
+		t.Fatal(err)
+	}
+	ui.key(keySnapshot)
+	lines = ui.transcript.lines
+	if len(lines) == 0 || !strings.HasPrefix(lines[len(lines)-1], "Snapshot failed:") {
+		t.Error("Got:", lines, "Expected:", "Snapshot failed: ...")
+	}
+}
+
+func TestTUIFrame(t *testing.T) {
+	ui := testTUI(t)
+	ui.height, ui.width = 12, 60
+	ui.transcript.Write([]byte("Welcome\n"))
+	ui.key('l')
+
+	frame := ui.frame()
+	rows := strings.Split(frame, "\x1b[")
+	// a cursor move per row, plus clearing the command line
+	if len(rows) != ui.height+2 {
+		t.Error("Got:", len(rows), "Expected:", ui.height+2)
+	}
+	if !strings.Contains(rows[1], "Welcome") || !strings.Contains(rows[1], "| state running") {
+		t.Errorf("Got: %q Expected the transcript and panel", rows[1])
+	}
+	if !strings.HasSuffix(rows[ui.height], "> l") {
+		t.Errorf("Got: %q Expected: %q", rows[ui.height], "> l")
+	}
+}
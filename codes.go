@@ -0,0 +1,171 @@
+package synacor
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Codes handed out by the challenge are 12 characters of letters and digits.
+const codeLength = 12
+
+var codeToken = regexp.MustCompile(`\b[A-Za-z0-9]{12}\b`)
+
+// Plain words (lower case, upper case or capitalized) are not codes even when
+// they happen to be 12 characters long, like "Introduction".
+var plainWord = regexp.MustCompile(`^(?:[A-Z]?[a-z]+|[A-Z]+)$`)
+
+// mirrored maps characters to how they look in a mirror; anything not listed
+// looks the same.
+var mirrored = map[rune]rune{
+	'b': 'd',
+	'd': 'b',
+	'p': 'q',
+	'q': 'p',
+}
+
+// Mirror returns the code as it reads when seen in a mirror: the characters are
+// reversed and the ones with a mirror image (b and d, p and q) are swapped.
+func Mirror(code string) string {
+	runes := []rune(code)
+	result := make([]rune, len(runes))
+
+	for i, c := range runes {
+		if m, ok := mirrored[c]; ok {
+			c = m
+		}
+		result[len(runes)-1-i] = c
+	}
+	return string(result)
+}
+
+// ExtractCodes returns the code shaped strings found in a transcript of the
+// game's output, in the order they first appear.
+func ExtractCodes(transcript string) []string {
+	codes := []string{}
+	seen := make(map[string]bool)
+
+	for _, token := range codeToken.FindAllString(transcript, -1) {
+		if !isCodeShaped(token) || seen[token] {
+			continue
+		}
+		seen[token] = true
+		codes = append(codes, token)
+	}
+	return codes
+}
+
+func isCodeShaped(s string) bool {
+	if len(s) != codeLength || strings.TrimSpace(s) != s {
+		return false
+	}
+	return codeToken.MatchString(s) && !plainWord.MatchString(s)
+}
+
+// codePhrase is a way the game introduces a code.  The code is the phrase's
+// submatch, or when next is true the phrase ends its line and the code is the
+// next line with anything on it, on its own.
+type codePhrase struct {
+	pattern *regexp.Regexp
+	next    bool
+}
+
+// Phrases the game hands out codes in.
+var codePhrases = []codePhrase{
+	{regexp.MustCompile(`challenge website: ([A-Za-z0-9]{12})\b`), false},
+	{regexp.MustCompile(`writing "([A-Za-z0-9]{12})"`), false},
+	{regexp.MustCompile(`you see "([A-Za-z0-9]{12})" scrawled`), false},
+	{regexp.MustCompile(`passageways, you see:\s*$`), true},
+	{regexp.MustCompile(`a pattern in the stars\.\.\.\s*$`), true},
+}
+
+// A code on a line of its own, after a phrase that ends the line before.
+var codeLine = regexp.MustCompile(`^\s*([A-Za-z0-9]{12})\s*$`)
+
+// Code is a code found in the game's output.
+type Code struct {
+	Code        string
+	Instruction uint64
+	Context     string
+}
+
+func (c Code) String() string {
+	return fmt.Sprintf("%s\t%d\t%s", c.Code, c.Instruction, strings.TrimSpace(c.Context))
+}
+
+// CodeWatcher collects codes from the game's output a character at a time, as
+// written by the out operation.  Only codes in the phrases the game hands them
+// out with are collected, not every 12 character word.
+type CodeWatcher struct {
+	Codes []Code
+
+	w       io.Writer
+	line    strings.Builder
+	seen    map[string]bool
+	lastErr error
+	// the last line with anything on it ends a phrase a code follows
+	pending bool
+}
+
+// NewCodeWatcher returns a CodeWatcher that also writes each code to w as soon
+// as it's found (w can be nil).
+func NewCodeWatcher(w io.Writer) *CodeWatcher {
+	return &CodeWatcher{w: w, seen: make(map[string]bool)}
+}
+
+// Err returns the last error writing a code out.
+func (c *CodeWatcher) Err() error {
+	return c.lastErr
+}
+
+// observe takes the next character of output and the count of instructions run
+// when it was written.
+func (c *CodeWatcher) observe(char rune, instruction uint64) {
+	if char != '\n' {
+		c.line.WriteRune(char)
+		return
+	}
+
+	line := c.line.String()
+	c.line.Reset()
+
+	if c.pending {
+		if m := codeLine.FindStringSubmatch(line); m != nil {
+			c.found(m[1], instruction, line)
+		}
+	}
+	if strings.TrimSpace(line) != "" {
+		c.pending = false
+	}
+
+	for _, phrase := range codePhrases {
+		if phrase.next {
+			c.pending = c.pending || phrase.pattern.MatchString(line)
+			continue
+		}
+		for _, m := range phrase.pattern.FindAllStringSubmatch(line, -1) {
+			c.found(m[1], instruction, line)
+		}
+	}
+}
+
+// found collects a code the first time it's seen.
+func (c *CodeWatcher) found(code string, instruction uint64, line string) {
+	if c.seen[code] {
+		return
+	}
+	c.seen[code] = true
+	c.add(Code{code, instruction, line})
+}
+
+func (c *CodeWatcher) add(code Code) {
+	c.Codes = append(c.Codes, code)
+
+	if c.w == nil {
+		return
+	}
+	if _, err := fmt.Fprintln(c.w, code); err != nil {
+		c.lastErr = err
+	}
+}
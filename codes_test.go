@@ -0,0 +1,140 @@
+package synacor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMirror(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"abc", "cda"},
+		{"pqbd", "bdpq"},
+		{"AbCdEfGhIjKl", "lKjIhGfEbCdA"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		result := Mirror(test.code)
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected)
+		}
+		if Mirror(result) != test.code {
+			t.Error("Got:", Mirror(result), "Expected:", test.code)
+		}
+	}
+}
+
+func TestExtractCodes(t *testing.T) {
+	transcript := `Welcome to the Synacor Challenge!
+Please record your progress by putting codes like
+this one into the challenge website: aB3dE5gH7jK9
+
+A Brief Introduction to Interdimensional Physics
+Chiseled on the wall of one of the passageways, you see:
+
+    XyZ12wvUt9Qp
+
+aB3dE5gH7jK9 again, and not a code: abcdefghijklm
+`
+
+	expected := []string{"aB3dE5gH7jK9", "XyZ12wvUt9Qp"}
+	result := ExtractCodes(transcript)
+
+	if len(result) != len(expected) {
+		t.Fatal("Got:", result, "Expected:", expected)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Error("Got:", result[i], "Expected:", expected[i])
+		}
+	}
+}
+
+func TestIsCodeShaped(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"aB3dE5gH7jK9", true},
+		{"abcdef123456", true},
+		{"Introduction", false},
+		{"introduction", false},
+		{"INTRODUCTION", false},
+		{"aB3dE5gH7jK", false},
+		{"aB3dE5gH7jK9a", false},
+		{"aB3dE5 H7jK9", false},
+	}
+
+	for _, test := range tests {
+		result := isCodeShaped(test.value)
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected, "Value:", test.value)
+		}
+	}
+}
+
+func TestCodeWatcher(t *testing.T) {
+	transcript := `Please record your progress by putting codes like
+this one into the challenge website: abcdefghijkl
+
+The introduction is not a code, nor is Introduction.
+Chiseled on the wall of one of the passageways, you see:
+
+    mnopqrstuvwx
+
+You find aB3dE5gH7jK9 and abcdefghijkl
+You find yourself writing "Xy1Zw2Vu3Ts4" on the tablet.
+`
+
+	var b strings.Builder
+	c := NewCodeWatcher(&b)
+	for i, char := range transcript {
+		c.observe(char, uint64(i))
+	}
+
+	expected := []Code{
+		{"abcdefghijkl", 99, "this one into the challenge website: abcdefghijkl"},
+		{"mnopqrstuvwx", 228, "    mnopqrstuvwx"},
+		{"Xy1Zw2Vu3Ts4", 324, `You find yourself writing "Xy1Zw2Vu3Ts4" on the tablet.`},
+	}
+
+	if len(c.Codes) != len(expected) {
+		t.Fatal("Got:", c.Codes, "Expected:", expected)
+	}
+	for i := range expected {
+		if c.Codes[i] != expected[i] {
+			t.Error("Got:", c.Codes[i], "Expected:", expected[i])
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != len(expected) || lines[1] != "mnopqrstuvwx\t228\tmnopqrstuvwx" {
+		t.Error("Got:", lines, "Expected:", len(expected), "lines")
+	}
+	if c.Err() != nil {
+		t.Error("Got:", c.Err(), "Expected:", nil)
+	}
+}
+
+func TestCodeWatcherStrayWords(t *testing.T) {
+	transcript := `You are in a room with a sign reading aB3dE5gH7jK9 on the wall.
+Exits: abcdefghijkl
+
+Chiseled on the wall of one of the passageways, you see:
+
+    the twisty little passages go on
+mnopqrstuvwx
+`
+
+	c := NewCodeWatcher(nil)
+	for i, char := range transcript {
+		c.observe(char, uint64(i))
+	}
+
+	if len(c.Codes) != 0 {
+		t.Error("Got:", c.Codes, "Expected:", []Code{})
+	}
+}
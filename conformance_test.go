@@ -0,0 +1,223 @@
+package synacor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// conformanceCase is a mini-program and what the arch-spec says running it
+// does.
+type conformanceCase struct {
+	name      string
+	src       string
+	input     string
+	output    string
+	stop      StopReason
+	registers map[int]uint16
+	memory    map[uint16]uint16
+	// pending is why the case is skipped, when the VM doesn't conform yet
+	pending string
+}
+
+// conformanceRun runs a program with input, for at most limit instructions,
+// and returns what it output and the Machine it ran on.
+type conformanceRun func(program []uint16, input string, limit uint64) (string, Machine)
+
+// How many instructions a conformance program may take.
+const conformanceLimit = 10000
+
+var conformanceCases = []conformanceCase{
+	{
+		name:   "halt stops",
+		src:    "halt; out 'x'",
+		stop:   Halted,
+		output: "",
+	},
+	{
+		name:   "out writes characters",
+		src:    "out 'h'; out 'i'; out '\\n'; halt",
+		stop:   Halted,
+		output: "hi\n",
+	},
+	{
+		name:      "set copies literals and registers",
+		src:       "set r0 5; set r1 r0; set r7 32767; halt",
+		stop:      Halted,
+		registers: map[int]uint16{0: 5, 1: 5, 7: 32767},
+	},
+	{
+		name:      "add wraps modulo 32768",
+		src:       "add r0 32758 15; add r1 32767 1; set r2 32767; add r3 r2 r2; halt",
+		stop:      Halted,
+		registers: map[int]uint16{0: 5, 1: 0, 3: 32766},
+	},
+	{
+		name: "mult wraps modulo 32768",
+		src: `mult r0 32767 32767; mult r1 200 200; mult r2 32766 7
+			set r3 32767; mult r4 r3 r3; halt`,
+		stop:      Halted,
+		registers: map[int]uint16{0: 1, 1: 7232, 2: 32754, 4: 1},
+	},
+	{
+		name:      "mod",
+		src:       "mod r0 32767 10; mod r1 6 7; set r2 3; mod r3 r2 r2; halt",
+		stop:      Halted,
+		registers: map[int]uint16{0: 7, 1: 6, 3: 0},
+	},
+	{
+		name:      "not stays 15 bit",
+		src:       "not r0 0; not r1 32767; not r2 21845; set r3 1; not r4 r3; halt",
+		stop:      Halted,
+		registers: map[int]uint16{0: 32767, 1: 0, 2: 10922, 4: 32766},
+	},
+	{
+		name:      "and, or",
+		src:       "and r0 12 10; or r1 12 10; set r2 32767; and r3 r2 21845; or r4 r2 0; halt",
+		stop:      Halted,
+		registers: map[int]uint16{0: 8, 1: 14, 3: 21845, 4: 32767},
+	},
+	{
+		name:      "eq, gt",
+		src:       "eq r0 3 3; eq r1 3 4; gt r2 4 3; gt r3 3 3; set r4 9; gt r5 r4 8; halt",
+		stop:      Halted,
+		registers: map[int]uint16{0: 1, 1: 0, 2: 1, 3: 0, 5: 1},
+	},
+	{
+		name: "jmp to a literal and a register",
+		src: `jmp a; out 'x'
+			a: set r0 b; jmp r0; out 'y'
+			b: out 'k'; halt`,
+		stop:   Halted,
+		output: "k",
+	},
+	{
+		name: "jt and jf with register conditions and targets",
+		src: `set r0 1; set r1 0; set r2 a; set r3 b
+			jt r0 r2; out 'x'
+			a: jt r1 fail; jf r1 r3; out 'y'
+			b: jf r0 fail; out 'k'; halt
+			fail: out 'f'; halt`,
+		stop:   Halted,
+		output: "k",
+	},
+	{
+		name:      "jt treats any nonzero value as true",
+		src:       "set r0 32767; jt r0 a; halt; a: set r1 1; halt",
+		stop:      Halted,
+		registers: map[int]uint16{1: 1},
+	},
+	{
+		name: "push and pop are last in, first out",
+		src:  "push 1; push 2; set r0 3; push r0; pop r1; pop r2; pop r3; halt",
+		stop: Halted,
+		registers: map[int]uint16{
+			1: 3, 2: 2, 3: 1,
+		},
+	},
+	{
+		name:      "rmem and wmem with literal and register addresses",
+		src:       "wmem a 42; set r0 a; rmem r1 r0; set r2 7; wmem r0 r2; rmem r3 a; halt; a: data 0",
+		stop:      Halted,
+		registers: map[int]uint16{1: 42, 3: 7},
+		memory:    map[uint16]uint16{19: 7},
+	},
+	{
+		name:   "wmem can change code before it runs",
+		src:    "wmem a+1 'k'; a: out 'x'; halt",
+		stop:   Halted,
+		output: "k",
+		memory: map[uint16]uint16{4: 'k'},
+	},
+	{
+		name: "call to a literal and a register, ret comes back",
+		src: `call f; set r0 g; call r0; halt
+			f: out 'f'; ret
+			g: out 'g'; ret`,
+		stop:   Halted,
+		output: "fg",
+	},
+	{
+		name:      "call pushes the address of the next instruction",
+		src:       "call f; halt; f: pop r0; halt",
+		stop:      Halted,
+		registers: map[int]uint16{0: 2},
+	},
+	{
+		name: "ret on an empty stack halts",
+		src:  "ret; out 'x'",
+		stop: Halted,
+	},
+	{
+		name:      "in reads a character at a time",
+		src:       "in r0; in r1; in r2; halt",
+		input:     "ab\n",
+		stop:      Halted,
+		registers: map[int]uint16{0: 'a', 1: 'b', 2: '\n'},
+	},
+	{
+		name:  "in stops when input runs out",
+		src:   "in r0; in r1",
+		input: "",
+		stop:  InputExhausted,
+	},
+	{
+		name:   "noop does nothing",
+		src:    "noop; noop; out 'k'",
+		stop:   EndOfProgram,
+		output: "k",
+	},
+	{
+		name: "pop on an empty stack is an error",
+		src:  "pop r0; out 'x'; halt",
+		stop: Faulted,
+	},
+}
+
+func runConformance(t *testing.T, run conformanceRun) {
+	for _, c := range conformanceCases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			if c.pending != "" {
+				t.Skip(c.pending)
+			}
+
+			program, err := Assemble(c.src, 0, nil)
+			if err != nil {
+				t.Fatal("Got:", err, "Expected:", nil)
+			}
+
+			output, m := run(program, c.input, conformanceLimit)
+
+			if m.Stopped() != c.stop {
+				t.Error("Got:", m.Stopped(), "Expected:", c.stop)
+			}
+			if output != c.output {
+				t.Errorf("Got: %q Expected: %q", output, c.output)
+			}
+			for n, v := range c.registers {
+				if m.Register(n) != v {
+					t.Error("Got:", m.Register(n), "Expected:", v, "In: r", n)
+				}
+			}
+			for a, v := range c.memory {
+				if m.Memory(a) != v {
+					t.Error("Got:", m.Memory(a), "Expected:", v, "At:", a)
+				}
+			}
+		})
+	}
+}
+
+func interpreterRun(program []uint16, input string, limit uint64) (string, Machine) {
+	var out bytes.Buffer
+	m := newTestMachine(program)
+	m.SetOutput(&out)
+	m.SetInput(strings.NewReader(input))
+	m.RunSteps(limit)
+	return out.String(), m
+}
+
+func TestConformance(t *testing.T) {
+	runConformance(t, interpreterRun)
+}
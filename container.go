@@ -0,0 +1,239 @@
+package synacor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Container is a program image with metadata describing it.  A container file
+// starts with magic bytes and a version, followed by sections: a tag, the
+// length of the section's data in bytes and the data, all little endian.
+// Sections with tags a reader doesn't know are skipped, so new ones can be
+// added without breaking older readers.
+type Container struct {
+	Title  string
+	Author string
+	// Entry is the address execution starts at
+	Entry     uint16
+	Registers [8]uint16
+	// Symbols name addresses in the image; nil if there are none
+	Symbols *Symbols
+	Image   []uint16
+	// Stack, bottom first, for a snapshot of a running Machine
+	Stack []uint16
+}
+
+// Magic bytes a container file starts with.  As a raw image the first word
+// would be an invalid opcode, so no runnable binary starts with them.
+var containerMagic = []byte("SYNACOR\x00")
+
+// Container format version written.
+const containerVersion = 1
+
+// Container section tags.
+const (
+	sectionImage uint16 = iota + 1
+	sectionTitle
+	sectionAuthor
+	sectionEntry
+	sectionRegisters
+	sectionSymbols
+	// CRC-32 (IEEE) of the image section's data
+	sectionChecksum
+	sectionStack
+)
+
+// IsContainer returns true if data starts like a container file.
+func IsContainer(data []byte) bool {
+	return bytes.HasPrefix(data, containerMagic)
+}
+
+// LoadProgram reads a file that's either a container or a raw image.  A raw
+// image is returned as a Container with only an Image.
+func LoadProgram(file string) (Container, error) {
+	fh, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return Container{}, err
+	}
+	defer fh.Close()
+
+	c, err := ReadProgram(fh)
+	if err != nil {
+		return c, fmt.Errorf("%s: %v", file, err)
+	}
+	return c, nil
+}
+
+// ReadProgram reads a container or, without the magic bytes, a raw image.
+func ReadProgram(r io.Reader) (Container, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Container{}, err
+	}
+
+	var c Container
+	if IsContainer(data) {
+		c, err = readContainer(data[len(containerMagic):])
+	} else {
+		c.Image, err = ReadImage(bytes.NewReader(data))
+	}
+	if err != nil {
+		return c, err
+	}
+
+	if len(c.Image) > maxMemory+1 {
+		return c, fmt.Errorf("%d words is more than fits in memory", len(c.Image))
+	}
+	return c, nil
+}
+
+func readContainer(data []byte) (Container, error) {
+	c := Container{}
+	r := bytes.NewReader(data)
+
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return c, fmt.Errorf("reading container version: %v", err)
+	}
+	if version > containerVersion {
+		return c, fmt.Errorf("container version %d is newer than %d", version, containerVersion)
+	}
+
+	sections := make(map[uint16][]byte)
+	for r.Len() > 0 {
+		var header struct {
+			Tag    uint16
+			Length uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+			return c, fmt.Errorf("reading section header: %v", err)
+		}
+		if int64(header.Length) > int64(r.Len()) {
+			return c, fmt.Errorf("section %d is %d bytes, only %d left", header.Tag, header.Length, r.Len())
+		}
+
+		section := make([]byte, header.Length)
+		if _, err := io.ReadFull(r, section); err != nil {
+			return c, err
+		}
+		sections[header.Tag] = section
+	}
+
+	image, ok := sections[sectionImage]
+	if !ok {
+		return c, fmt.Errorf("container has no image")
+	}
+	if sum, ok := sections[sectionChecksum]; ok {
+		if len(sum) != 4 {
+			return c, fmt.Errorf("checksum is %d bytes, expected 4", len(sum))
+		}
+		if want, got := binary.LittleEndian.Uint32(sum), crc32.ChecksumIEEE(image); got != want {
+			return c, fmt.Errorf("checksum is %08x, expected %08x", got, want)
+		}
+	}
+
+	var err error
+	if c.Image, err = ReadImage(bytes.NewReader(image)); err != nil {
+		return c, fmt.Errorf("reading image: %v", err)
+	}
+
+	c.Title = string(sections[sectionTitle])
+	c.Author = string(sections[sectionAuthor])
+
+	if entry, ok := sections[sectionEntry]; ok {
+		if len(entry) != 2 {
+			return c, fmt.Errorf("entry is %d bytes, expected 2", len(entry))
+		}
+		c.Entry = binary.LittleEndian.Uint16(entry)
+		if c.Entry > maxMemory {
+			return c, fmt.Errorf("entry %d is past the end of memory", c.Entry)
+		}
+	}
+
+	if registers, ok := sections[sectionRegisters]; ok {
+		if len(registers) != 16 {
+			return c, fmt.Errorf("registers are %d bytes, expected 16", len(registers))
+		}
+		binary.Read(bytes.NewReader(registers), binary.LittleEndian, &c.Registers)
+		for n, v := range c.Registers {
+			if !isLiteralValue(v) {
+				return c, fmt.Errorf("r%d is %d, not a number", n, v)
+			}
+		}
+	}
+
+	if symbols, ok := sections[sectionSymbols]; ok {
+		if c.Symbols, err = ParseSymbols(bytes.NewReader(symbols)); err != nil {
+			return c, fmt.Errorf("reading symbols: %v", err)
+		}
+	}
+
+	if stack, ok := sections[sectionStack]; ok {
+		if c.Stack, err = ReadImage(bytes.NewReader(stack)); err != nil {
+			return c, fmt.Errorf("reading stack: %v", err)
+		}
+	}
+	return c, nil
+}
+
+// Write writes the container.  Empty metadata is left out.
+func (c Container) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.Write(containerMagic)
+	binary.Write(bw, binary.LittleEndian, uint16(containerVersion))
+
+	var image bytes.Buffer
+	binary.Write(&image, binary.LittleEndian, c.Image)
+
+	checksum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(image.Bytes()))
+
+	entry := make([]byte, 2)
+	binary.LittleEndian.PutUint16(entry, c.Entry)
+
+	var registers bytes.Buffer
+	binary.Write(&registers, binary.LittleEndian, c.Registers)
+
+	var symbols strings.Builder
+	if c.Symbols != nil {
+		if err := c.Symbols.Write(&symbols); err != nil {
+			return err
+		}
+	}
+
+	var stack bytes.Buffer
+	binary.Write(&stack, binary.LittleEndian, c.Stack)
+
+	sections := []struct {
+		tag   uint16
+		data  []byte
+		empty bool
+	}{
+		{sectionTitle, []byte(c.Title), c.Title == ""},
+		{sectionAuthor, []byte(c.Author), c.Author == ""},
+		{sectionEntry, entry, c.Entry == 0},
+		{sectionRegisters, registers.Bytes(), c.Registers == [8]uint16{}},
+		{sectionSymbols, []byte(symbols.String()), symbols.Len() == 0},
+		{sectionImage, image.Bytes(), false},
+		{sectionChecksum, checksum, false},
+		{sectionStack, stack.Bytes(), len(c.Stack) == 0},
+	}
+
+	for _, s := range sections {
+		if s.empty {
+			continue
+		}
+		binary.Write(bw, binary.LittleEndian, s.tag)
+		binary.Write(bw, binary.LittleEndian, uint32(len(s.data)))
+		bw.Write(s.data)
+	}
+	return bw.Flush()
+}
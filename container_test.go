@@ -0,0 +1,233 @@
+package synacor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testContainer() Container {
+	symbols := NewSymbols()
+	symbols.Add(Symbol{Address: 2, Type: Function, Name: "main", Comment: "says hi"})
+
+	return Container{
+		Title:     "hi",
+		Author:    "pladdy",
+		Entry:     2,
+		Registers: [8]uint16{1, 2, 3, 4, 5, 6, 7, 32767},
+		Symbols:   symbols,
+		Image:     []uint16{uint16(opHalt), 0, uint16(opOut), 'h', uint16(opOut), 'i', uint16(opHalt)},
+		Stack:     []uint16{0, 6},
+	}
+}
+
+func TestContainerRoundTrip(t *testing.T) {
+	tests := []Container{
+		testContainer(),
+		{Image: []uint16{uint16(opHalt)}},
+		{Image: []uint16{}},
+		{Image: []uint16{uint16(opHalt)}, Stack: []uint16{0}},
+	}
+
+	for _, c := range tests {
+		var b bytes.Buffer
+		if err := c.Write(&b); err != nil {
+			t.Fatal("Got:", err, "Expected:", nil)
+		}
+		if !IsContainer(b.Bytes()) {
+			t.Error("Got:", b.Bytes()[:8], "Expected:", containerMagic)
+		}
+
+		result, err := ReadProgram(&b)
+		if err != nil {
+			t.Fatal("Got:", err, "Expected:", nil)
+		}
+
+		if result.Title != c.Title || result.Author != c.Author || result.Entry != c.Entry {
+			t.Error("Got:", result.Title, result.Author, result.Entry, "Expected:", c.Title, c.Author, c.Entry)
+		}
+		if result.Registers != c.Registers {
+			t.Error("Got:", result.Registers, "Expected:", c.Registers)
+		}
+		if len(result.Stack) != len(c.Stack) || (len(c.Stack) > 0 && !reflect.DeepEqual(result.Stack, c.Stack)) {
+			t.Error("Got:", result.Stack, "Expected:", c.Stack)
+		}
+		if len(result.Image) != len(c.Image) || (len(c.Image) > 0 && !reflect.DeepEqual(result.Image, c.Image)) {
+			t.Error("Got:", result.Image, "Expected:", c.Image)
+		}
+		if c.Symbols == nil {
+			if result.Symbols != nil {
+				t.Error("Got:", result.Symbols.All(), "Expected:", nil)
+			}
+		} else if !reflect.DeepEqual(result.Symbols.All(), c.Symbols.All()) {
+			t.Error("Got:", result.Symbols.All(), "Expected:", c.Symbols.All())
+		}
+	}
+}
+
+func TestReadProgramRaw(t *testing.T) {
+	result, err := ReadProgram(bytes.NewReader([]byte{19, 0, 65, 0}))
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	expected := Container{Image: []uint16{19, 65}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Error("Got:", result, "Expected:", expected)
+	}
+}
+
+// section returns a container section's bytes.
+func section(tag uint16, data []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, tag)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+// container returns a container file from sections.
+func container(sections ...[]byte) []byte {
+	b := append([]byte(nil), containerMagic...)
+	b = append(b, containerVersion, 0)
+	for _, s := range sections {
+		b = append(b, s...)
+	}
+	return b
+}
+
+func TestReadProgramSkipsUnknownSections(t *testing.T) {
+	data := container(section(999, []byte("from the future")), section(sectionImage, []byte{19, 0, 65, 0}))
+
+	result, err := ReadProgram(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if !reflect.DeepEqual(result.Image, []uint16{19, 65}) {
+		t.Error("Got:", result.Image, "Expected:", []uint16{19, 65})
+	}
+}
+
+func TestReadProgramErrors(t *testing.T) {
+	var good bytes.Buffer
+	if err := testContainer().Write(&good); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := append([]byte(nil), good.Bytes()...)
+	// the last word of the image, just before the checksum section
+	corrupt[len(corrupt)-11]++
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"no version", containerMagic, "reading container version"},
+		{"newer version", append(append([]byte(nil), containerMagic...), 2, 0), "newer"},
+		{"no image", container(section(sectionTitle, []byte("hi"))), "no image"},
+		{"truncated section", container(section(sectionImage, []byte{19, 0}))[:len(containerMagic)+8], "only 0 left"},
+		{"odd image", container(section(sectionImage, []byte{19, 0, 65})), "reading image"},
+		{"corrupt image", corrupt, "checksum"},
+		{"bad entry", container(section(sectionImage, nil), section(sectionEntry, []byte{0, 0x80})), "entry 32768"},
+		{"bad registers", container(section(sectionImage, nil), section(sectionRegisters, []byte{1})), "registers are 1 bytes"},
+		{"register not a number", container(section(sectionImage, nil), section(sectionRegisters, append([]byte{0, 0x80}, make([]byte, 14)...))), "r0 is 32768"},
+		{"bad symbols", container(section(sectionImage, nil), section(sectionSymbols, []byte("1 nope x"))), "reading symbols"},
+	}
+
+	for _, test := range tests {
+		_, err := ReadProgram(bytes.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Error("Got:", err, "Expected:", test.err, "For:", test.name)
+		}
+	}
+}
+
+func TestMachineLoadContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "synacor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "hi.syn")
+	fh, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testContainer().Write(fh); err != nil {
+		t.Fatal(err)
+	}
+	fh.Close()
+
+	m := newTestMachine(nil)
+	if err := m.Load(file); err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	if m.PC() != 2 {
+		t.Error("Got:", m.PC(), "Expected:", 2)
+	}
+	if m.Register(7) != 32767 {
+		t.Error("Got:", m.Register(7), "Expected:", 32767)
+	}
+	if m.Symbols().Name(2) != "main" {
+		t.Error("Got:", m.Symbols().Name(2), "Expected:", "main")
+	}
+	if !reflect.DeepEqual(*m.Stack, stack{0, 6}) {
+		t.Error("Got:", *m.Stack, "Expected:", stack{0, 6})
+	}
+
+	var out bytes.Buffer
+	m.SetOutput(&out)
+	if stop := m.RunSteps(10); stop != Halted || out.String() != "hi" {
+		t.Error("Got:", stop, out.String(), "Expected:", Halted, "hi")
+	}
+}
+
+func TestMachineSnapshot(t *testing.T) {
+	m := newTestMachine([]uint16{uint16(opPush), 7, uint16(opSet), register3, 9, uint16(opOut), 'k', uint16(opHalt)})
+	m.RunSteps(2)
+
+	var b bytes.Buffer
+	if err := m.Snapshot("after set").Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "synacor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "snapshot.syn")
+	if err := ioutil.WriteFile(file, b.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newTestMachine(nil)
+	if err := restored.Load(file); err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	if restored.PC() != 5 {
+		t.Error("Got:", restored.PC(), "Expected:", 5)
+	}
+	if restored.Register(3) != 9 {
+		t.Error("Got:", restored.Register(3), "Expected:", 9)
+	}
+	if !reflect.DeepEqual(*restored.Stack, stack{7}) {
+		t.Error("Got:", *restored.Stack, "Expected:", stack{7})
+	}
+
+	var out bytes.Buffer
+	restored.SetOutput(&out)
+	restored.RunSteps(10)
+	if out.String() != "k" {
+		t.Error("Got:", out.String(), "Expected:", "k")
+	}
+}
@@ -0,0 +1,283 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pladdy/synacor"
+)
+
+// echo prints a prompt, calls read to echo a line and halts.
+const echo = `# echo a line
+start:	out '>'
+	call read
+	halt
+
+read:	in r0
+	out r0
+	eq r1 r0 '\n'
+	jf r1 read
+	ret
+`
+
+// testClient talks to a Session through pipes.
+type testClient struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	seq    int
+	output string
+}
+
+// testMessage is any message from the Session.
+type testMessage struct {
+	Type    string          `json:"type"`
+	Command string          `json:"command"`
+	Event   string          `json:"event"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Body    json.RawMessage `json:"body"`
+}
+
+func newTestClient(t *testing.T) *testClient {
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	go NewSession(requests, responses).Serve()
+	t.Cleanup(func() {
+		requestWriter.Close()
+		responseReader.Close()
+	})
+	return &testClient{t: t, w: requestWriter, r: bufio.NewReader(responseReader)}
+}
+
+// send a request without waiting for the response.
+func (c *testClient) send(command string, args interface{}) {
+	c.seq++
+	arguments, err := json.Marshal(args)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req := request{message{c.seq, "request"}, command, arguments}
+	if err := writeMessage(c.w, req); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// expect reads messages until one of kind (response or event) called name,
+// collecting output events on the way, and decodes its body into body.
+func (c *testClient) expect(kind, name string, body interface{}) testMessage {
+	for {
+		content, err := readMessage(c.r)
+		if err != nil {
+			c.t.Fatal("Got:", err, "Expected:", kind, name)
+		}
+
+		var m testMessage
+		if err := json.Unmarshal(content, &m); err != nil {
+			c.t.Fatal(err)
+		}
+		if m.Type == "event" && m.Event == "output" {
+			var o outputEvent
+			json.Unmarshal(m.Body, &o)
+			c.output += o.Output
+			continue
+		}
+		if m.Type != kind || m.Command+m.Event != name {
+			c.t.Fatal("Got:", m.Type, m.Command+m.Event, string(m.Body), "Expected:", kind, name)
+		}
+
+		if body != nil {
+			if err := json.Unmarshal(m.Body, body); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return m
+	}
+}
+
+// do sends a request and returns its response.
+func (c *testClient) do(command string, args, body interface{}) testMessage {
+	c.send(command, args)
+	return c.expect("response", command, body)
+}
+
+// stopped expects a stopped event for a reason.
+func (c *testClient) stopped(reason string) {
+	var e stoppedEvent
+	c.expect("event", "stopped", &e)
+	if e.Reason != reason {
+		c.t.Fatal("Got:", e.Reason, e.Text, "Expected:", reason)
+	}
+}
+
+// launch has the Session run a program.
+func (c *testClient) launch(args launchArguments) {
+	if m := c.do("initialize", map[string]string{"adapterID": "synacor"}, nil); !m.Success {
+		c.t.Fatal("Got:", m.Message, "Expected: initialize to succeed")
+	}
+	if m := c.do("launch", args, nil); !m.Success {
+		c.t.Fatal("Got:", m.Message, "Expected: launch to succeed")
+	}
+	c.expect("event", "initialized", nil)
+}
+
+func testFile(t *testing.T, name string, content []byte) string {
+	dir, err := ioutil.TempDir("", "synacor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func setBreakpoints(path string, lines ...int) setBreakpointsArguments {
+	args := setBreakpointsArguments{Source: source{Path: path}}
+	for _, l := range lines {
+		args.Breakpoints = append(args.Breakpoints, sourceBreakpoint{l})
+	}
+	return args
+}
+
+func TestSessionSource(t *testing.T) {
+	path := testFile(t, "echo.asm", []byte(echo))
+	c := newTestClient(t)
+	c.launch(launchArguments{Source: path})
+
+	// line 5 is blank, so its breakpoint moves to the in on line 6
+	var set struct{ Breakpoints []breakpoint }
+	c.do("setBreakpoints", setBreakpoints(path, 5, 7), &set)
+	expected := []breakpoint{{Verified: true, Line: 6}, {Verified: true, Line: 7}}
+	if !reflect.DeepEqual(set.Breakpoints, expected) {
+		t.Error("Got:", set.Breakpoints, "Expected:", expected)
+	}
+
+	c.do("configurationDone", nil, nil)
+	c.stopped("breakpoint")
+
+	var trace struct{ StackFrames []stackFrame }
+	c.do("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	lines := []int{}
+	for _, f := range trace.StackFrames {
+		lines = append(lines, f.Line)
+		if f.Source == nil || f.Source.Path != path {
+			t.Error("Got:", f.Source, "Expected:", path)
+		}
+	}
+	if !reflect.DeepEqual(lines, []int{6, 3}) {
+		t.Error("Got:", lines, "Expected:", []int{6, 3})
+	}
+
+	var stack struct{ Variables []variable }
+	c.do("variables", map[string]int{"variablesReference": stackReference}, &stack)
+	if len(stack.Variables) != 1 || stack.Variables[0].Value != "4 (return to 4)" {
+		t.Error("Got:", stack.Variables, "Expected:", "4 (return to 4)")
+	}
+
+	// waits for input, then stops after echoing the first character
+	c.do("continue", map[string]int{"threadId": threadID}, nil)
+	c.do("evaluate", evaluateArguments{"hi", "repl"}, nil)
+	c.stopped("breakpoint")
+
+	c.do("setBreakpoints", setBreakpoints(path), nil)
+	c.do("stepOut", map[string]int{"threadId": threadID}, nil)
+	c.stopped("step")
+	if c.output != ">hi\n" {
+		t.Errorf("Got: %q Expected: %q", c.output, ">hi\n")
+	}
+
+	var result struct{ Result string }
+	c.do("evaluate", evaluateArguments{"r0", "hover"}, &result)
+	if result.Result != "10" {
+		t.Error("Got:", result.Result, "Expected:", "10")
+	}
+
+	c.do("next", map[string]int{"threadId": threadID}, nil)
+	c.expect("event", "exited", nil)
+	c.expect("event", "terminated", nil)
+	c.do("disconnect", nil, nil)
+}
+
+func TestSessionProgram(t *testing.T) {
+	program, err := synacor.Assemble("call f; halt; f: out 'x'; ret", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := make([]byte, 2*len(program))
+	for i, word := range program {
+		binary.LittleEndian.PutUint16(image[2*i:], word)
+	}
+	bin := testFile(t, "test.bin", image)
+	listing := filepath.Join(filepath.Dir(bin), "test.dasm")
+
+	c := newTestClient(t)
+	c.launch(launchArguments{Program: bin, Listing: listing, StopOnEntry: true})
+
+	b, err := ioutil.ReadFile(listing)
+	if err != nil || !strings.Contains(string(b), "call 3") {
+		t.Error("Got:", string(b), err, "Expected: a listing")
+	}
+
+	c.do("configurationDone", nil, nil)
+	c.stopped("entry")
+
+	// steps over the call
+	c.do("next", map[string]int{"threadId": threadID}, nil)
+	c.stopped("step")
+
+	var registers struct{ Variables []variable }
+	c.do("variables", map[string]int{"variablesReference": registersReference}, &registers)
+	if len(registers.Variables) != 10 || registers.Variables[8].Value != "2" || c.output != "x" {
+		t.Error("Got:", registers.Variables, c.output, "Expected: pc 2 with x printed")
+	}
+}
+
+func TestSessionPause(t *testing.T) {
+	c := newTestClient(t)
+	c.launch(launchArguments{Source: testFile(t, "loop.asm", []byte("loop: jmp loop"))})
+
+	c.do("configurationDone", nil, nil)
+	c.do("pause", map[string]int{"threadId": threadID}, nil)
+	c.stopped("pause")
+}
+
+func TestSessionErrors(t *testing.T) {
+	c := newTestClient(t)
+
+	tests := []struct {
+		command string
+		args    interface{}
+		want    string
+	}{
+		{"stackTrace", nil, "launch a program first"},
+		{"launch", launchArguments{}, "needs a program or source"},
+		{"launch", launchArguments{Source: testFile(t, "bad.asm", []byte("jump 1"))}, "unknown operation"},
+	}
+
+	for _, test := range tests {
+		m := c.do(test.command, test.args, nil)
+		if m.Success || !strings.Contains(m.Message, test.want) {
+			t.Error("Got:", m.Success, m.Message, "Expected:", test.want)
+		}
+	}
+
+	c.launch(launchArguments{Source: testFile(t, "echo.asm", []byte(echo))})
+	if m := c.do("evaluate", evaluateArguments{"mem[0]", "watch"}, nil); m.Success {
+		t.Error("Got:", m.Success, "Expected:", false)
+	}
+	if m := c.do("restartFrame", nil, nil); m.Success || !strings.Contains(m.Message, "isn't supported") {
+		t.Error("Got:", m.Success, m.Message, "Expected:", "isn't supported")
+	}
+}
@@ -0,0 +1,535 @@
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pladdy/synacor"
+)
+
+// The Machine is the only thread.
+const threadID = 1
+
+// Instructions run between letting requests look at the Machine.
+const runBatch = 10000
+
+// References to the variables in each scope.
+const (
+	registersReference = 1
+	stackReference     = 2
+)
+
+// Session debugs a Machine for one client.
+type Session struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// guards writing messages
+	wmu sync.Mutex
+	seq int
+
+	// guards the rest, which the goroutine running the Machine uses too
+	mu sync.Mutex
+	m  synacor.Machine
+	// the file breakpoints and stack frames refer to, and where each address
+	// is in it
+	path        string
+	lines       synacor.SourceMap
+	launched    bool
+	stopOnEntry bool
+	breakpoints map[uint16]bool
+	// lines of input queued for the game
+	input   []string
+	output  bytes.Buffer
+	running bool
+
+	// set to 1 to stop running
+	paused int32
+	// wakes the Machine when it's waiting for input
+	wake chan struct{}
+}
+
+// NewSession returns a Session that reads requests from r and writes responses
+// and events to w.
+func NewSession(r io.Reader, w io.Writer) *Session {
+	return &Session{
+		in:          bufio.NewReader(r),
+		out:         w,
+		breakpoints: make(map[uint16]bool),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Serve handles requests until the client disconnects.
+func (s *Session) Serve() error {
+	defer s.pause()
+
+	for {
+		content, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+
+		body, then, err := s.handle(req)
+		if err := s.respond(req, body, err); err != nil {
+			return err
+		}
+		if then != nil {
+			then()
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// handle runs a request and returns the body of the response and anything to
+// do after responding, like sending events.
+func (s *Session) handle(req request) (interface{}, func(), error) {
+	if !s.launched && req.Command != "initialize" && req.Command != "launch" && req.Command != "disconnect" {
+		return nil, nil, errors.New("launch a program first")
+	}
+
+	switch req.Command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		}, nil, nil
+	case "launch":
+		var args launchArguments
+		if err := unmarshal(req.Arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		if err := s.launch(args); err != nil {
+			return nil, nil, err
+		}
+		// configuration requests, like setting breakpoints, come after this
+		return nil, func() { s.event("initialized", nil) }, nil
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := unmarshal(req.Arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		return s.setBreakpoints(args), nil, nil
+	case "configurationDone":
+		if s.stopOnEntry {
+			return nil, func() { s.event("stopped", s.stopped("entry", "")) }, nil
+		}
+		return nil, func() { s.resume("", nil) }, nil
+	case "threads":
+		return map[string][]thread{"threads": {{threadID, "vm"}}}, nil, nil
+	case "stackTrace":
+		frames := s.stackTrace()
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil, nil
+	case "scopes":
+		return map[string][]scope{"scopes": {
+			{"Registers", registersReference, false},
+			{"Stack", stackReference, false},
+		}}, nil, nil
+	case "variables":
+		var args variablesArguments
+		if err := unmarshal(req.Arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		return map[string][]variable{"variables": s.variables(args.VariablesReference)}, nil, nil
+	case "continue":
+		return map[string]bool{"allThreadsContinued": true}, func() { s.resume("", nil) }, nil
+	case "next":
+		return nil, func() { s.resume("step", s.stepOver()) }, nil
+	case "stepIn":
+		return nil, func() { s.resume("step", stepped) }, nil
+	case "stepOut":
+		return nil, func() { s.resume("step", s.stepOut()) }, nil
+	case "pause":
+		s.pause()
+		return nil, nil, nil
+	case "evaluate":
+		var args evaluateArguments
+		if err := unmarshal(req.Arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		result, err := s.evaluate(args)
+		return map[string]interface{}{"result": result, "variablesReference": 0}, nil, err
+	case "disconnect":
+		return nil, nil, nil
+	}
+	return nil, nil, fmt.Errorf("%s isn't supported", req.Command)
+}
+
+func unmarshal(arguments json.RawMessage, v interface{}) error {
+	if len(arguments) == 0 {
+		return nil
+	}
+	return json.Unmarshal(arguments, v)
+}
+
+// launch loads the program, assembling it if it's source, and writes its
+// disassembly if it isn't.
+func (s *Session) launch(args launchArguments) error {
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	m.SetOutput(&s.output)
+
+	var symbols *synacor.Symbols
+	if args.Symbols != "" {
+		var err error
+		if symbols, err = synacor.LoadSymbols(args.Symbols); err != nil {
+			return err
+		}
+	}
+
+	path := args.Source
+	switch {
+	case args.Source != "":
+		src, err := ioutil.ReadFile(filepath.Clean(args.Source))
+		if err != nil {
+			return err
+		}
+		program, lines, err := synacor.AssembleSource(string(src), 0, symbols)
+		if err != nil {
+			return err
+		}
+		m.LoadContainer(synacor.Container{Image: program, Symbols: symbols})
+		s.lines = lines
+	case args.Program != "":
+		if err := m.Load(args.Program); err != nil {
+			return err
+		}
+		// they replace a container's own symbols
+		if symbols != nil {
+			m.SetSymbols(symbols)
+		}
+
+		path = args.Listing
+		if path == "" {
+			path = args.Program + ".dasm"
+		}
+		lines, err := writeListing(path, m)
+		if err != nil {
+			return err
+		}
+		s.lines = lines
+	default:
+		return errors.New("launch needs a program or source")
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m, s.path, s.launched, s.stopOnEntry = m, abs, true, args.StopOnEntry
+	return nil
+}
+
+// writeListing writes the disassembly of m to a file.
+func writeListing(file string, m synacor.Machine) (synacor.SourceMap, error) {
+	fh, err := os.Create(filepath.Clean(file))
+	if err != nil {
+		return synacor.SourceMap{}, err
+	}
+	lines, err := synacor.WriteListing(fh, m.Image(), m.Symbols())
+	if err != nil {
+		fh.Close()
+		return lines, err
+	}
+	return lines, fh.Close()
+}
+
+// setBreakpoints replaces the breakpoints with ones on the lines given, each
+// moved to the next line with an instruction if it doesn't have one.
+func (s *Session) setBreakpoints(args setBreakpointsArguments) map[string][]breakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ours := false
+	if abs, err := filepath.Abs(args.Source.Path); err == nil && abs == s.path {
+		ours = true
+		s.breakpoints = make(map[uint16]bool)
+	}
+
+	breakpoints := []breakpoint{}
+	for _, b := range args.Breakpoints {
+		if !ours {
+			breakpoints = append(breakpoints, breakpoint{Message: "breakpoints go in " + s.path})
+			continue
+		}
+
+		address, line, ok := s.lines.Address(b.Line)
+		if !ok {
+			breakpoints = append(breakpoints, breakpoint{Message: "no instructions on or after this line"})
+			continue
+		}
+		s.breakpoints[address] = true
+		breakpoints = append(breakpoints, breakpoint{Verified: true, Line: line})
+	}
+	return map[string][]breakpoint{"breakpoints": breakpoints}
+}
+
+// resume runs the Machine in the background until it hits a breakpoint, is
+// paused, stops or done returns true after an instruction, which stops it for
+// reason.
+func (s *Session) resume(reason string, done func(m synacor.Machine) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	atomic.StoreInt32(&s.paused, 0)
+	go s.run(reason, done)
+}
+
+// stepped is done after any instruction.
+func stepped(synacor.Machine) bool {
+	return true
+}
+
+func (s *Session) run(reason string, done func(m synacor.Machine) bool) {
+	first := true
+	for {
+		s.mu.Lock()
+		stop, exited, waiting := s.batch(reason, done, &first)
+		output := s.output.String()
+		s.output.Reset()
+		if stop != nil || exited {
+			s.running = false
+		}
+		s.mu.Unlock()
+
+		if output != "" {
+			s.event("output", outputEvent{"stdout", output})
+		}
+		switch {
+		case stop != nil:
+			s.event("stopped", stop)
+			return
+		case exited:
+			s.event("exited", map[string]int{"exitCode": 0})
+			s.event("terminated", nil)
+			return
+		case waiting:
+			<-s.wake
+		}
+	}
+}
+
+// batch runs up to runBatch instructions, with the lock held.  It returns why
+// it stopped, if it did, whether the program ended and whether it's waiting
+// for input.
+func (s *Session) batch(reason string, done func(m synacor.Machine) bool, first *bool) (*stoppedEvent, bool, bool) {
+	for n := 0; n < runBatch; n++ {
+		switch {
+		case atomic.LoadInt32(&s.paused) == 1:
+			return s.stopped("pause", ""), false, false
+		case !*first && s.breakpoints[uint16(s.m.PC())]:
+			return s.stopped("breakpoint", ""), false, false
+		case !*first && done != nil && done(s.m):
+			return s.stopped(reason, ""), false, false
+		case s.m.WaitingForInput():
+			if len(s.input) == 0 {
+				return nil, false, true
+			}
+			s.m.SetInput(strings.NewReader(s.input[0]))
+			s.input = s.input[1:]
+		}
+
+		s.m.Step()
+		*first = false
+
+		if f := s.m.Fault(); f != nil {
+			return s.stopped("exception", f.Error()), false, false
+		}
+		if s.m.Stopped() != synacor.NotStopped {
+			return nil, true, false
+		}
+	}
+	return nil, false, false
+}
+
+func (s *Session) stopped(reason, text string) *stoppedEvent {
+	return &stoppedEvent{Reason: reason, Text: text, ThreadID: threadID, AllThreadsStopped: true}
+}
+
+// pause stops the Machine if it's running.
+func (s *Session) pause() {
+	atomic.StoreInt32(&s.paused, 1)
+	s.notify()
+}
+
+// notify wakes the Machine if it's waiting for input.
+func (s *Session) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stepOver returns a done function that steps over a call, or executes one
+// instruction if the next one isn't a call.
+func (s *Session) stepOver() func(m synacor.Machine) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.m.Decode(uint16(s.m.PC()))
+	if i.Name != "call" {
+		return stepped
+	}
+	return returned(i.Address+uint16(i.Size()), len(*s.m.Stack))
+}
+
+// stepOut returns a done function that runs until the current function
+// returns.
+func (s *Session) stepOut() func(m synacor.Machine) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.m.Backtrace()
+	if len(b) == 0 {
+		return stepped
+	}
+	return returned(b[0].Return, b[0].Depth-1)
+}
+
+// returned is done when the Machine is at address with the stack no deeper
+// than depth.
+func returned(address uint16, depth int) func(m synacor.Machine) bool {
+	return func(m synacor.Machine) bool {
+		return m.PC() == int(address) && len(*m.Stack) <= depth
+	}
+}
+
+// frames returns the addresses of the call stack, innermost first: the PC,
+// then the call each function was called from.
+func (s *Session) frames() []uint16 {
+	frames := []uint16{uint16(s.m.PC())}
+	for _, f := range s.m.Backtrace() {
+		frames = append(frames, f.Call)
+	}
+	return frames
+}
+
+func (s *Session) stackTrace() []stackFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src := &source{Name: filepath.Base(s.path), Path: s.path}
+	frames := []stackFrame{}
+	for n, address := range s.frames() {
+		line, _ := s.lines.Line(address)
+		frames = append(frames, stackFrame{
+			ID:                          n + 1,
+			Name:                        s.m.Symbols().Name(address),
+			Source:                      src,
+			Line:                        line,
+			Column:                      1,
+			InstructionPointerReference: strconv.Itoa(int(address)),
+		})
+	}
+	return frames
+}
+
+func (s *Session) variables(reference int) []variable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	variables := []variable{}
+	switch reference {
+	case registersReference:
+		for n := 0; n < 8; n++ {
+			variables = append(variables, variable{Name: fmt.Sprintf("r%d", n), Value: strconv.Itoa(int(s.m.Register(n)))})
+		}
+		variables = append(variables,
+			variable{Name: "pc", Value: strconv.Itoa(s.m.PC())},
+			variable{Name: "steps", Value: strconv.FormatUint(s.m.Steps(), 10)})
+	case stackReference:
+		// top first, with where the calls return to
+		returns := map[int]bool{}
+		for _, f := range s.m.Backtrace() {
+			returns[f.Depth-1] = !f.Tampered
+		}
+		stack := *s.m.Stack
+		for i := len(stack) - 1; i >= 0; i-- {
+			value := strconv.Itoa(int(stack[i]))
+			if returns[i] {
+				value += " (return to " + s.m.Symbols().Name(stack[i]) + ")"
+			}
+			variables = append(variables, variable{Name: fmt.Sprintf("[%d]", len(stack)-1-i), Value: value})
+		}
+	}
+	return variables
+}
+
+// evaluate sends what's typed in the debug console to the game as input, and
+// shows registers when they're hovered over or watched.
+func (s *Session) evaluate(args evaluateArguments) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if args.Context == "repl" {
+		s.input = append(s.input, args.Expression+"\n")
+		s.notify()
+		return "", nil
+	}
+
+	name := strings.TrimSpace(args.Expression)
+	if name == "pc" {
+		return strconv.Itoa(s.m.PC()), nil
+	}
+	if len(name) == 2 && name[0] == 'r' && name[1] >= '0' && name[1] <= '7' {
+		return strconv.Itoa(int(s.m.Register(int(name[1] - '0')))), nil
+	}
+	return "", fmt.Errorf("can't evaluate %q, only registers and pc", name)
+}
+
+func (s *Session) respond(req request, body interface{}, err error) error {
+	resp := response{
+		message:    message{Type: "response"},
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	resp.Seq = s.seq
+	return writeMessage(s.out, resp)
+}
+
+// event sends an event; there's no one to tell if it can't be sent.
+func (s *Session) event(name string, body interface{}) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	writeMessage(s.out, event{message{s.seq, "event"}, name, body})
+}
@@ -0,0 +1,691 @@
+package synacor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Decompiled is a function lifted to pseudo-code by a Decompiler.
+type Decompiled struct {
+	Address uint16
+	Name    string
+	// Args are the registers the function reads before it writes them, which
+	// callers pass it in
+	Args []int
+	// Saves are the registers pushed when the function starts and popped
+	// before every return
+	Saves []int
+	// Clobbers are the registers the function writes and doesn't save
+	Clobbers []int
+	Code     string
+}
+
+// Decompiler lifts functions in memory to C-like pseudo-code: registers are
+// variables, jt, jf and jmp become if, else and while where the jumps nest and
+// goto where they don't, push and pop pairs saving registers are left out and
+// calls are function calls with the registers the callee reads as arguments.
+// Arithmetic is modulo 32768, as in the VM.
+type Decompiler struct {
+	memory    []uint16
+	symbols   *Symbols
+	functions map[uint16]*function
+}
+
+// function is what the Decompiler finds out about a function.
+type function struct {
+	entry uint16
+	// instructions reachable from the entry, by address and in order
+	code  map[uint16]Instruction
+	order []uint16
+	// addresses jumped to from inside the function
+	targets map[uint16]bool
+	// registers saved, and the pushes and pops that save and restore them
+	saves    []uint16
+	saving   map[uint16]bool
+	restores map[uint16]bool
+	// where pops restoring registers start, and so where jumps return
+	returns map[uint16]bool
+
+	args, clobbers registerSet
+}
+
+// registerSet has bit n set for register n.
+type registerSet uint8
+
+func (s registerSet) list() []int {
+	l := []int{}
+	for n := 0; n < 8; n++ {
+		if s&(1<<n) != 0 {
+			l = append(l, n)
+		}
+	}
+	return l
+}
+
+func registerBit(a uint16) registerSet {
+	if !isRegister(a) {
+		return 0
+	}
+	return 1 << (a - registerStart)
+}
+
+// NewDecompiler returns a Decompiler for a program's memory, naming functions
+// and labels with symbols (which can be nil).
+func NewDecompiler(memory []uint16, symbols *Symbols) *Decompiler {
+	return &Decompiler{memory, symbols, make(map[uint16]*function)}
+}
+
+// Functions returns the addresses of the program's functions, in order: its
+// function symbols and the addresses it calls.
+func (d *Decompiler) Functions() []uint16 {
+	found := make(map[uint16]bool)
+	for _, sym := range d.symbols.All() {
+		if sym.Type == Function {
+			found[sym.Address] = true
+		}
+	}
+	for _, i := range Disassemble(d.memory) {
+		if t, ok := i.Target(); ok && opcode(i.Opcode) == opCall && int(t) < len(d.memory) {
+			found[t] = true
+		}
+	}
+
+	addresses := []uint16{}
+	for a := range found {
+		addresses = append(addresses, a)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+	return addresses
+}
+
+// Decompile lifts the function at an address.
+func (d *Decompiler) Decompile(address uint16) Decompiled {
+	f := d.analyze(address)
+	saves := []int{}
+	for _, r := range f.saves {
+		saves = append(saves, int(r-registerStart))
+	}
+
+	w := &pseudoWriter{d: d, f: f, loops: make(map[uint16]bool), gotos: make(map[uint16]bool)}
+	w.write(f)
+
+	return Decompiled{
+		Address:  address,
+		Name:     d.functionName(address),
+		Args:     f.args.list(),
+		Saves:    saves,
+		Clobbers: f.clobbers.list(),
+		Code:     w.String(),
+	}
+}
+
+// functionName returns the name of the function at an address: its symbol,
+// or sub_<address>.
+func (d *Decompiler) functionName(address uint16) string {
+	if sym, ok := d.symbols.Lookup(address); ok {
+		return sym.Name
+	}
+	return fmt.Sprintf("sub_%d", address)
+}
+
+// labelName returns the name of an address jumped to.
+func (d *Decompiler) labelName(address uint16) string {
+	name := d.symbols.Name(address)
+	if _, err := strconv.Atoi(name); err == nil {
+		return "L" + name
+	}
+	return name
+}
+
+// analyze finds the function at an address, what it saves and which registers
+// it reads and writes, once.
+func (d *Decompiler) analyze(entry uint16) *function {
+	if f, ok := d.functions[entry]; ok {
+		return f
+	}
+	f := &function{entry: entry, code: make(map[uint16]Instruction), targets: make(map[uint16]bool)}
+	d.functions[entry] = f
+
+	d.reach(f)
+	f.findSaves()
+	// a function that calls itself sees what it reads from the last pass
+	for {
+		args, clobbers := f.args, f.clobbers
+		d.liveness(f)
+		if f.args == args && f.clobbers == clobbers {
+			return f
+		}
+	}
+}
+
+// reach finds the instructions reachable from the function's entry without
+// following calls.
+func (d *Decompiler) reach(f *function) {
+	work := []uint16{f.entry}
+	for len(work) > 0 {
+		a := work[len(work)-1]
+		work = work[:len(work)-1]
+		if _, ok := f.code[a]; ok || int(a) >= len(d.memory) {
+			continue
+		}
+
+		i := Decode(d.memory, a)
+		f.code[a] = i
+		f.order = append(f.order, a)
+		if t, ok := i.Target(); ok && opcode(i.Opcode) != opCall {
+			f.targets[t] = true
+		}
+		work = append(work, successors(i)...)
+	}
+	sort.Slice(f.order, func(i, j int) bool { return f.order[i] < f.order[j] })
+}
+
+// successors returns where the program can go after an instruction, leaving
+// out calls and jumps to registers.
+func successors(i Instruction) []uint16 {
+	next := i.Address + uint16(i.Size())
+	if !i.Valid() {
+		return nil
+	}
+
+	switch opcode(i.Opcode) {
+	case opHalt, opRet:
+		return nil
+	case opJmp:
+		if t, ok := i.Target(); ok {
+			return []uint16{t}
+		}
+		return nil
+	case opJt, opJf:
+		if t, ok := i.Target(); ok {
+			return []uint16{next, t}
+		}
+	}
+	return []uint16{next}
+}
+
+// findSaves finds registers pushed when the function starts and popped, in
+// reverse, right before every ret.  Nothing can jump between the pops, or into
+// the pushes.
+func (f *function) findSaves() {
+	f.saving = make(map[uint16]bool)
+	f.restores = make(map[uint16]bool)
+	f.returns = make(map[uint16]bool)
+
+	pushes := []Instruction{}
+	for a := f.entry; ; {
+		i, ok := f.code[a]
+		if !ok || !i.Valid() || opcode(i.Opcode) != opPush || !isRegister(i.Args[0]) || f.targets[a] {
+			break
+		}
+		pushes = append(pushes, i)
+		a += uint16(i.Size())
+	}
+
+	rets := []uint16{}
+	for _, a := range f.order {
+		if opcode(f.code[a].Opcode) == opRet && f.code[a].Valid() {
+			rets = append(rets, a)
+		}
+	}
+	if len(rets) == 0 {
+		return
+	}
+
+	k := len(pushes)
+	for _, r := range rets {
+		if n := f.pops(r, pushes); n < k {
+			k = n
+		}
+	}
+
+	f.saves = nil
+	for _, p := range pushes[:k] {
+		f.saves = append(f.saves, p.Args[0])
+		f.saving[p.Address] = true
+	}
+	for _, r := range rets {
+		start := r
+		for n := 0; n < k; n++ {
+			start = f.before(start)
+			f.restores[start] = true
+		}
+		f.returns[start] = true
+	}
+}
+
+// pops returns how many of the pushes are popped, in reverse, right before the
+// ret at an address.
+func (f *function) pops(ret uint16, pushes []Instruction) int {
+	a := ret
+	for n := 0; n < len(pushes); n++ {
+		// a jump past a pop would skip restoring its register
+		if f.targets[a] {
+			return n
+		}
+		prev := f.before(a)
+		i := f.code[prev]
+		if prev == a || !i.Valid() || opcode(i.Opcode) != opPop || i.Args[0] != pushes[n].Args[0] {
+			return n
+		}
+		a = prev
+	}
+	return len(pushes)
+}
+
+// before returns the address of the instruction that runs into the one at an
+// address, or the address itself if there isn't one.
+func (f *function) before(address uint16) uint16 {
+	n := sort.Search(len(f.order), func(n int) bool { return f.order[n] >= address })
+	if n == 0 {
+		return address
+	}
+	prev := f.order[n-1]
+	if i := f.code[prev]; prev+uint16(i.Size()) != address || !i.Valid() || len(successors(i)) == 0 || opcode(i.Opcode) == opJmp {
+		return address
+	}
+	return prev
+}
+
+// uses returns the registers an instruction reads and writes; saving and
+// restoring registers doesn't count.
+func (d *Decompiler) uses(f *function, i Instruction) (use, def registerSet) {
+	if !i.Valid() || f.saving[i.Address] || f.restores[i.Address] {
+		return 0, 0
+	}
+
+	op := opcode(i.Opcode)
+	for n, a := range i.Args {
+		if n == 0 && writesRegister[op] {
+			def |= registerBit(a)
+			continue
+		}
+		use |= registerBit(a)
+	}
+
+	if t, ok := i.Target(); ok && op == opCall && int(t) < len(d.memory) {
+		callee := d.analyze(t)
+		use |= callee.args
+		def |= callee.clobbers
+	}
+	return use, def
+}
+
+// liveness works out the registers the function reads before writing, its
+// arguments, and the ones it writes without saving.
+func (d *Decompiler) liveness(f *function) {
+	use := make(map[uint16]registerSet)
+	def := make(map[uint16]registerSet)
+	var clobbers registerSet
+	for _, a := range f.order {
+		use[a], def[a] = d.uses(f, f.code[a])
+		clobbers |= def[a]
+	}
+	for _, r := range f.saves {
+		clobbers &^= registerBit(r)
+	}
+
+	live := make(map[uint16]registerSet)
+	for changed := true; changed; {
+		changed = false
+		for n := len(f.order) - 1; n >= 0; n-- {
+			a := f.order[n]
+			var out registerSet
+			for _, s := range successors(f.code[a]) {
+				out |= live[s]
+			}
+			in := use[a] | out&^def[a]
+			if in != live[a] {
+				live[a] = in
+				changed = true
+			}
+		}
+	}
+	f.args, f.clobbers = live[f.entry], clobbers
+}
+
+// pseudoWriter writes a function's pseudo-code.
+type pseudoWriter struct {
+	d     *Decompiler
+	f     *function
+	lines []pseudoLine
+	// loops being written, innermost last, and the headers of all of them
+	stack []loop
+	loops map[uint16]bool
+	// addresses gone to
+	gotos map[uint16]bool
+}
+
+type pseudoLine struct {
+	depth int
+	text  string
+	// the line is the label for this address, if it's gone to
+	label   uint16
+	isLabel bool
+}
+
+type loop struct {
+	header, exit uint16
+	// continue goes back to the header; in a do-while it would go to the
+	// condition instead
+	continues bool
+}
+
+func (w *pseudoWriter) line(depth int, format string, a ...interface{}) {
+	w.lines = append(w.lines, pseudoLine{depth: depth, text: fmt.Sprintf(format, a...)})
+}
+
+func (w *pseudoWriter) write(f *function) {
+	header := fmt.Sprintf("// %s at %d", w.d.functionName(f.entry), f.entry)
+	if len(f.saves) > 0 {
+		header += ", saves " + strings.Join(registerNames(f.saves), ", ")
+	}
+	w.line(0, "%s", header)
+
+	args := []uint16{}
+	for _, r := range f.args.list() {
+		args = append(args, uint16(r)+registerStart)
+	}
+	w.line(0, "%s(%s) {", w.d.functionName(f.entry), strings.Join(registerNames(args), ", "))
+
+	if len(f.order) > 0 {
+		if f.order[0] != f.entry {
+			w.line(1, "%s", w.jump(f.entry))
+		}
+		last := f.code[f.order[len(f.order)-1]]
+		w.block(f.order[0], last.Address+uint16(last.Size()), 1)
+	}
+	w.line(0, "}")
+}
+
+// String returns the pseudo-code, with labels only where there's a goto.
+func (w *pseudoWriter) String() string {
+	var b strings.Builder
+	for _, l := range w.lines {
+		if l.isLabel {
+			if w.gotos[l.label] {
+				fmt.Fprintf(&b, "%s:\n", w.d.labelName(l.label))
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "%s%s\n", strings.Repeat("    ", l.depth), l.text)
+	}
+	return b.String()
+}
+
+// next returns the address of the first instruction at or after an address.
+func (w *pseudoWriter) next(address uint16) (uint16, bool) {
+	order := w.f.order
+	n := sort.Search(len(order), func(n int) bool { return order[n] >= address })
+	if n == len(order) {
+		return 0, false
+	}
+	return order[n], true
+}
+
+// previous returns the last instruction before an address.
+func (w *pseudoWriter) previous(address uint16) (Instruction, bool) {
+	order := w.f.order
+	n := sort.Search(len(order), func(n int) bool { return order[n] >= address })
+	if n == 0 {
+		return Instruction{}, false
+	}
+	return w.f.code[order[n-1]], true
+}
+
+// block writes the instructions from lo up to hi.
+func (w *pseudoWriter) block(lo, hi uint16, depth int) {
+	for a, ok := w.next(lo); ok && a < hi; a, ok = w.next(a) {
+		// a loop's header is labelled before the loop
+		if !w.loops[a] {
+			w.lines = append(w.lines, pseudoLine{label: a, isLabel: true})
+		}
+		if back, ok := w.backJump(a, hi); ok {
+			a = w.loop(a, back, depth)
+			continue
+		}
+		a = w.instruction(w.f.code[a], hi, depth)
+	}
+}
+
+// backJump returns the last jump back to an address before hi, which makes
+// the address the start of a loop.
+func (w *pseudoWriter) backJump(header, hi uint16) (Instruction, bool) {
+	if w.loops[header] || !w.f.targets[header] {
+		return Instruction{}, false
+	}
+
+	var back Instruction
+	found := false
+	for a, ok := w.next(header); ok && a < hi; a, ok = w.next(a + 1) {
+		i := w.f.code[a]
+		if t, ok := i.Target(); ok && t == header && opcode(i.Opcode) != opCall {
+			back, found = i, true
+		}
+	}
+	return back, found
+}
+
+// loop writes the loop from header to the jump back to it, returning where to
+// carry on from.
+func (w *pseudoWriter) loop(header uint16, back Instruction, depth int) uint16 {
+	exit := back.Address + uint16(back.Size())
+	first := w.f.code[header]
+	w.loops[header] = true
+	defer delete(w.loops, header)
+
+	switch {
+	case opcode(back.Opcode) != opJmp:
+		w.stack = append(w.stack, loop{header, exit, false})
+		w.line(depth, "do {")
+		w.block(header, back.Address, depth+1)
+		w.line(depth, "} while (%s);", w.cond(back, true))
+	case first.Address != back.Address && w.exits(first, exit):
+		w.stack = append(w.stack, loop{header, exit, true})
+		w.line(depth, "while (%s) {", w.cond(first, false))
+		w.block(header+uint16(first.Size()), back.Address, depth+1)
+		w.line(depth, "}")
+	default:
+		w.stack = append(w.stack, loop{header, exit, true})
+		w.line(depth, "while (true) {")
+		w.block(header, back.Address, depth+1)
+		w.line(depth, "}")
+	}
+	w.stack = w.stack[:len(w.stack)-1]
+	return exit
+}
+
+// exits returns true if an instruction is a jt or jf to an address.
+func (w *pseudoWriter) exits(i Instruction, address uint16) bool {
+	op := opcode(i.Opcode)
+	t, ok := i.Target()
+	return ok && t == address && (op == opJt || op == opJf)
+}
+
+// instruction writes an instruction, and for a jt or jf the if it starts,
+// returning where to carry on from.
+func (w *pseudoWriter) instruction(i Instruction, hi uint16, depth int) uint16 {
+	next := i.Address + uint16(i.Size())
+	op := opcode(i.Opcode)
+	if !i.Valid() {
+		w.line(depth, "fault(); // data %d", i.Opcode)
+		return next
+	}
+	if op == opNoop || w.f.saving[i.Address] || w.f.restores[i.Address] {
+		return next
+	}
+
+	switch op {
+	case opJmp:
+		w.line(depth, "%s", w.jumpTo(i))
+		return next
+	case opJt, opJf:
+		t, ok := i.Target()
+		if !ok || t <= i.Address || t > hi || w.structured(t) {
+			w.line(depth, "if (%s) %s", w.cond(i, true), w.jumpTo(i))
+			return next
+		}
+		return w.ifElse(i, t, hi, depth)
+	}
+	w.line(depth, "%s", w.statement(i))
+	return next
+}
+
+// structured returns true if a jump to an address is a break or continue.
+func (w *pseudoWriter) structured(address uint16) bool {
+	if len(w.stack) == 0 {
+		return false
+	}
+	l := w.stack[len(w.stack)-1]
+	return address == l.exit || address == l.header && l.continues
+}
+
+// ifElse writes the if a jt or jf jumping forward over code starts, with an
+// else if the code ends jumping forward over more, returning where to carry
+// on from.
+func (w *pseudoWriter) ifElse(i Instruction, target, hi uint16, depth int) uint16 {
+	then := i.Address + uint16(i.Size())
+	w.line(depth, "if (%s) {", w.cond(i, false))
+
+	last, ok := w.previous(target)
+	end, jumps := last.Target()
+	if ok && last.Address >= then && opcode(last.Opcode) == opJmp && jumps && end > target && end <= hi && !w.structured(end) {
+		w.block(then, last.Address, depth+1)
+		w.line(depth, "} else {")
+		w.block(target, end, depth+1)
+		w.line(depth, "}")
+		return end
+	}
+
+	w.block(then, target, depth+1)
+	w.line(depth, "}")
+	return target
+}
+
+// jumpTo returns the statement for a jump: return, break, continue or goto.
+func (w *pseudoWriter) jumpTo(i Instruction) string {
+	t, ok := i.Target()
+	if !ok {
+		n := jumpArg[opcode(i.Opcode)]
+		return fmt.Sprintf("jump(%s);", operandName(i.Args[n]))
+	}
+	return w.jump(t)
+}
+
+func (w *pseudoWriter) jump(address uint16) string {
+	if i, ok := w.f.code[address]; w.f.returns[address] || ok && opcode(i.Opcode) == opRet && i.Valid() {
+		return "return;"
+	}
+	if len(w.stack) > 0 {
+		l := w.stack[len(w.stack)-1]
+		if address == l.exit {
+			return "break;"
+		}
+		if address == l.header && l.continues {
+			return "continue;"
+		}
+	}
+	w.gotos[address] = true
+	return "goto " + w.d.labelName(address) + ";"
+}
+
+// cond returns the condition a jt or jf jumps on, or if jumps is false the
+// condition it doesn't.
+func (w *pseudoWriter) cond(i Instruction, jumps bool) string {
+	onTrue := opcode(i.Opcode) == opJt
+	if !jumps {
+		onTrue = !onTrue
+	}
+
+	a := i.Args[0]
+	if !isRegister(a) {
+		return strconv.FormatBool((a != 0) == onTrue)
+	}
+	if onTrue {
+		return operandName(a)
+	}
+	return "!" + operandName(a)
+}
+
+// statement returns the pseudo-code for an instruction that doesn't jump.
+func (w *pseudoWriter) statement(i Instruction) string {
+	args := make([]string, len(i.Args))
+	for n, a := range i.Args {
+		args[n] = operandName(a)
+	}
+
+	switch opcode(i.Opcode) {
+	case opHalt:
+		return "halt();"
+	case opSet:
+		return fmt.Sprintf("%s = %s;", args[0], args[1])
+	case opPush:
+		return fmt.Sprintf("push(%s);", args[0])
+	case opPop:
+		return fmt.Sprintf("%s = pop();", args[0])
+	case opEq:
+		return fmt.Sprintf("%s = %s == %s;", args[0], args[1], args[2])
+	case opGt:
+		return fmt.Sprintf("%s = %s > %s;", args[0], args[1], args[2])
+	case opAdd:
+		return fmt.Sprintf("%s = %s + %s;", args[0], args[1], args[2])
+	case opMult:
+		return fmt.Sprintf("%s = %s * %s;", args[0], args[1], args[2])
+	case opMod:
+		return fmt.Sprintf("%s = %s %% %s;", args[0], args[1], args[2])
+	case opAnd:
+		return fmt.Sprintf("%s = %s & %s;", args[0], args[1], args[2])
+	case opOr:
+		return fmt.Sprintf("%s = %s | %s;", args[0], args[1], args[2])
+	case opNot:
+		return fmt.Sprintf("%s = ~%s;", args[0], args[1])
+	case opRmem:
+		return fmt.Sprintf("%s = mem[%s];", args[0], args[1])
+	case opWmem:
+		return fmt.Sprintf("mem[%s] = %s;", args[0], args[1])
+	case opCall:
+		return w.call(i)
+	case opRet:
+		return "return;"
+	case opOut:
+		if !isRegister(i.Args[0]) {
+			args[0] = quoteChar(i.Args[0])
+		}
+		return fmt.Sprintf("out(%s);", args[0])
+	case opIn:
+		return fmt.Sprintf("%s = in();", args[0])
+	}
+	return ""
+}
+
+// call returns a call to a function, passing it the registers it reads.
+func (w *pseudoWriter) call(i Instruction) string {
+	t, ok := i.Target()
+	if !ok || int(t) >= len(w.d.memory) {
+		return fmt.Sprintf("call(%s);", operandName(i.Args[0]))
+	}
+
+	args := []uint16{}
+	for _, r := range w.d.analyze(t).args.list() {
+		args = append(args, uint16(r)+registerStart)
+	}
+	return fmt.Sprintf("%s(%s);", w.d.functionName(t), strings.Join(registerNames(args), ", "))
+}
+
+// operandName returns a register's name or a number.
+func operandName(a uint16) string {
+	if isRegister(a) {
+		return fmt.Sprintf("r%d", a-registerStart)
+	}
+	return strconv.Itoa(int(a))
+}
+
+func registerNames(registers []uint16) []string {
+	names := []string{}
+	for _, r := range registers {
+		names = append(names, operandName(r))
+	}
+	return names
+}
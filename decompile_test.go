@@ -0,0 +1,185 @@
+package synacor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecompile(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "while loop with saved registers",
+			src: `	call f; halt
+f:	push r1
+	push r2
+	set r1 0
+loop:	gt r2 r1 r0
+	jt r2 done
+	out r1
+	add r1 r1 1
+	jmp loop
+done:	pop r2
+	pop r1
+	ret`,
+			want: `// sub_3 at 3, saves r1, r2
+sub_3(r0) {
+    r1 = 0;
+    while (true) {
+        r2 = r1 > r0;
+        if (r2) return;
+        out(r1);
+        r1 = r1 + 1;
+    }
+    return;
+}
+`,
+		},
+		{
+			name: "while with a condition",
+			src: `	call f; halt
+f:	jf r0 done
+	add r0 r0 32767
+	out '.'
+	jmp f
+done:	ret`,
+			want: `// sub_3 at 3
+sub_3(r0) {
+    while (r0) {
+        r0 = r0 + 32767;
+        out('.');
+    }
+    return;
+}
+`,
+		},
+		{
+			name: "if else",
+			src: `	call f; halt
+f:	jf r0 else
+	set r0 1
+	jmp end
+else:	set r0 2
+end:	ret`,
+			want: `// sub_3 at 3
+sub_3(r0) {
+    if (r0) {
+        r0 = 1;
+    } else {
+        r0 = 2;
+    }
+    return;
+}
+`,
+		},
+		{
+			name: "do while",
+			src: `	call f; halt
+f:	add r0 r0 1
+	eq r1 r0 10
+	jf r1 f
+	ret`,
+			want: `// sub_3 at 3
+sub_3(r0) {
+    do {
+        r0 = r0 + 1;
+        r1 = r0 == 10;
+    } while (!r1);
+    return;
+}
+`,
+		},
+		{
+			name: "calls pass what the callee reads",
+			src: `	call f; halt
+f:	push r0
+	set r3 r1
+	call g
+	pop r0
+	ret
+g:	add r0 r3 r5
+	ret`,
+			want: `// sub_3 at 3, saves r0
+sub_3(r1, r5) {
+    r3 = r1;
+    sub_13(r3, r5);
+    return;
+}
+`,
+		},
+		{
+			name: "jumps that don't nest",
+			src: `	call f; halt
+f:	jt r0 mid
+top:	out 'a'
+mid:	out 'b'
+	jt r1 top
+	ret`,
+			want: `// sub_3 at 3
+sub_3(r0, r1) {
+    if (!r0) {
+L6:
+        out('a');
+    }
+    out('b');
+    if (r1) goto L6;
+    return;
+}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		program, err := Assemble(test.src, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := NewDecompiler(program, nil).Decompile(3).Code
+		if got != test.want {
+			t.Errorf("Got:\n%s\nExpected:\n%s\nFor: %s", got, test.want, test.name)
+		}
+	}
+}
+
+func TestDecompileRegisters(t *testing.T) {
+	program, err := Assemble(`	call f; halt
+f:	push r2
+	set r3 r1
+	call g
+	jt r0 0
+	pop r2
+	ret
+g:	add r2 r3 r5
+	set r0 r2
+	ret`, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// f's call writes r0, so f doesn't read it
+	got := NewDecompiler(program, nil).Decompile(3)
+	want := Decompiled{Address: 3, Name: "sub_3", Args: []int{1, 5}, Saves: []int{2}, Clobbers: []int{0, 3}}
+	got.Code = ""
+	if !reflect.DeepEqual(got, want) {
+		t.Error("Got:", got, "Expected:", want)
+	}
+}
+
+func TestDecompilerFunctions(t *testing.T) {
+	program, err := Assemble("call 5; call 32768; halt; ret; ret", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols := NewSymbols()
+	symbols.Add(Symbol{Address: 6, Type: Function, Name: "unused"})
+	symbols.Add(Symbol{Address: 4, Type: Label, Name: "label"})
+
+	got := NewDecompiler(program, symbols).Functions()
+	if want := []uint16{5, 6}; !reflect.DeepEqual(got, want) {
+		t.Error("Got:", got, "Expected:", want)
+	}
+}
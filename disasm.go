@@ -0,0 +1,155 @@
+package synacor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Instruction is an operation decoded from memory.
+type Instruction struct {
+	Address uint16
+	Opcode  uint16
+	// Name of the operation, empty when Opcode isn't a valid operation or its
+	// arguments run past the end of memory
+	Name string
+	Args []uint16
+}
+
+// Operations whose first argument is a register to write to.
+var writesRegister = map[opcode]bool{
+	opSet: true, opPop: true, opEq: true, opGt: true, opAdd: true, opMult: true,
+	opMod: true, opAnd: true, opOr: true, opNot: true, opRmem: true, opIn: true,
+}
+
+// Operations with an address to jump to, and which argument it is.
+var jumpArg = map[opcode]int{opJmp: 0, opCall: 0, opJt: 1, opJf: 1}
+
+// Operations that end a basic block: they jump, or (wmem) might change the
+// code after them.
+var endsBlock = map[opcode]bool{
+	opJmp: true, opJt: true, opJf: true, opCall: true, opRet: true, opWmem: true,
+}
+
+// Decode the instruction at an address.
+func Decode(memory []uint16, address uint16) Instruction {
+	i := Instruction{Address: address}
+	if int(address) >= len(memory) {
+		return i
+	}
+
+	i.Opcode = memory[address]
+	properties, ok := operatorPropertyMap[opcode(i.Opcode)]
+	if !ok || int(i.Opcode) != int(opcode(i.Opcode)) || int(address)+properties.args >= len(memory) {
+		return i
+	}
+
+	i.Name = properties.name
+	i.Args = append([]uint16(nil), memory[int(address)+1:int(address)+1+properties.args]...)
+	return i
+}
+
+// Valid returns true if the instruction is an operation.
+func (i Instruction) Valid() bool {
+	return i.Name != ""
+}
+
+// Size returns how many words the instruction takes up; an invalid instruction
+// is one word of data.
+func (i Instruction) Size() int {
+	return 1 + len(i.Args)
+}
+
+// WritesRegister returns true if the instruction writes to the register in its
+// first argument.
+func (i Instruction) WritesRegister() bool {
+	return i.Valid() && writesRegister[opcode(i.Opcode)]
+}
+
+// EndsBlock returns true if the instruction ends a basic block: it jumps, or
+// (wmem) might change the code after it.
+func (i Instruction) EndsBlock() bool {
+	return i.Valid() && endsBlock[opcode(i.Opcode)]
+}
+
+// Compilable returns true if the instruction can be run without the
+// interpreter, as RunCached and cmd/syn2go do: halt and in are left to it, as
+// are instructions that always fault.
+func (i Instruction) Compilable() bool {
+	op := opcode(i.Opcode)
+	if !i.Valid() || op == opHalt || op == opIn {
+		return false
+	}
+	for n, a := range i.Args {
+		if !isValid(a) || n == 0 && i.WritesRegister() && !isRegister(a) {
+			return false
+		}
+	}
+	return op != opMod || i.Args[2] != 0
+}
+
+// Target returns the address the instruction jumps to, if it jumps to a literal
+// address.
+func (i Instruction) Target() (uint16, bool) {
+	n, ok := jumpArg[opcode(i.Opcode)]
+	if !ok || !i.Valid() || !isLiteralValue(i.Args[n]) {
+		return 0, false
+	}
+	return i.Args[n], true
+}
+
+// String formats the instruction as assembly.
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
+
+// Format formats the instruction as assembly, naming addresses it jumps to with
+// symbols (which can be nil).
+func (i Instruction) Format(symbols *Symbols) string {
+	if !i.Valid() {
+		return "data " + strconv.Itoa(int(i.Opcode))
+	}
+
+	parts := []string{i.Name}
+	target, jumps := jumpArg[opcode(i.Opcode)]
+
+	for n, a := range i.Args {
+		switch {
+		case isRegister(a):
+			parts = append(parts, fmt.Sprintf("r%d", a-registerStart))
+		case !isValid(a):
+			parts = append(parts, strconv.Itoa(int(a)))
+		case jumps && n == target:
+			parts = append(parts, symbols.Name(a))
+		case opcode(i.Opcode) == opOut:
+			parts = append(parts, quoteChar(a))
+		default:
+			parts = append(parts, strconv.Itoa(int(a)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteChar formats a value as a character literal when it's printable.
+func quoteChar(a uint16) string {
+	switch {
+	case a == '\n':
+		return `'\n'`
+	case a == '\'' || a == '\\':
+		return `'\` + string(rune(a)) + `'`
+	case a >= ' ' && a <= '~':
+		return "'" + string(rune(a)) + "'"
+	}
+	return strconv.Itoa(int(a))
+}
+
+// Disassemble decodes memory from the start, one instruction after another.
+func Disassemble(memory []uint16) []Instruction {
+	instructions := []Instruction{}
+	for a := 0; a < len(memory); {
+		i := Decode(memory, uint16(a))
+		instructions = append(instructions, i)
+		a += i.Size()
+	}
+	return instructions
+}
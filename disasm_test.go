@@ -0,0 +1,162 @@
+package synacor
+
+import "testing"
+
+func TestDecode(t *testing.T) {
+	memory := []uint16{
+		uint16(opSet), register7, 25734,
+		uint16(opCall), 6027,
+		uint16(opOut), '\n',
+		uint16(opJt), register0, 12,
+		300,
+		uint16(opAdd), register0,
+	}
+
+	tests := []struct {
+		address  uint16
+		expected string
+		size     int
+	}{
+		{0, "set r7 25734", 3},
+		{3, "call 6027", 2},
+		{5, `out '\n'`, 2},
+		{7, "jt r0 12", 3},
+		{10, "data 300", 1},
+		{11, "data 9", 1},
+		{13, "data 0", 1},
+	}
+
+	for _, test := range tests {
+		i := Decode(memory, test.address)
+		if i.String() != test.expected {
+			t.Error("Got:", i.String(), "Expected:", test.expected)
+		}
+		if i.Size() != test.size {
+			t.Error("Got:", i.Size(), "Expected:", test.size)
+		}
+	}
+}
+
+func TestInstructionFormat(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 6027, Type: Function, Name: "confirm_teleporter"})
+
+	tests := []struct {
+		memory   []uint16
+		expected string
+	}{
+		{[]uint16{uint16(opCall), 6027}, "call confirm_teleporter"},
+		{[]uint16{uint16(opJf), register1, 6030}, "jf r1 confirm_teleporter+3"},
+		{[]uint16{uint16(opJmp), register0}, "jmp r0"},
+		{[]uint16{uint16(opOut), 'A'}, "out 'A'"},
+		{[]uint16{uint16(opOut), '\''}, `out '\''`},
+		{[]uint16{uint16(opOut), 7}, "out 7"},
+		{[]uint16{uint16(opSet), 40000, 1}, "set 40000 1"},
+	}
+
+	for _, test := range tests {
+		result := Decode(test.memory, 0).Format(s)
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected)
+		}
+	}
+}
+
+func TestInstructionTarget(t *testing.T) {
+	tests := []struct {
+		memory   []uint16
+		target   uint16
+		expected bool
+	}{
+		{[]uint16{uint16(opCall), 6027}, 6027, true},
+		{[]uint16{uint16(opJt), register0, 12}, 12, true},
+		{[]uint16{uint16(opJmp), register0}, 0, false},
+		{[]uint16{uint16(opOut), 65}, 0, false},
+	}
+
+	for _, test := range tests {
+		target, ok := Decode(test.memory, 0).Target()
+		if target != test.target || ok != test.expected {
+			t.Error("Got:", target, ok, "Expected:", test.target, test.expected)
+		}
+	}
+}
+
+func TestInstructionWritesRegister(t *testing.T) {
+	tests := []struct {
+		memory   []uint16
+		expected bool
+	}{
+		{[]uint16{uint16(opSet), register0, 1}, true},
+		{[]uint16{uint16(opIn), register0}, true},
+		{[]uint16{uint16(opWmem), register0, 1}, false},
+		{[]uint16{uint16(opOut), register0}, false},
+		{[]uint16{uint16(opSet), register0}, false},
+	}
+
+	for _, test := range tests {
+		result := Decode(test.memory, 0).WritesRegister()
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected, "Memory:", test.memory)
+		}
+	}
+}
+
+func TestInstructionEndsBlock(t *testing.T) {
+	tests := []struct {
+		memory   []uint16
+		expected bool
+	}{
+		{[]uint16{uint16(opJmp), 4}, true},
+		{[]uint16{uint16(opRet)}, true},
+		{[]uint16{uint16(opWmem), 4, 1}, true},
+		{[]uint16{uint16(opAdd), register0, 1, 2}, false},
+		{[]uint16{uint16(opJmp)}, false},
+	}
+
+	for _, test := range tests {
+		result := Decode(test.memory, 0).EndsBlock()
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected, "Memory:", test.memory)
+		}
+	}
+}
+
+func TestInstructionCompilable(t *testing.T) {
+	tests := []struct {
+		memory   []uint16
+		expected bool
+	}{
+		{[]uint16{uint16(opAdd), register0, 1, register1}, true},
+		{[]uint16{uint16(opOut), 'a'}, true},
+		{[]uint16{uint16(opMod), register0, 1, register1}, true},
+		{[]uint16{uint16(opHalt)}, false},
+		{[]uint16{uint16(opIn), register0}, false},
+		{[]uint16{uint16(opSet), 1, 2}, false},
+		{[]uint16{uint16(opJmp), 32776}, false},
+		{[]uint16{uint16(opMod), register0, 1, 0}, false},
+		{[]uint16{99}, false},
+	}
+
+	for _, test := range tests {
+		result := Decode(test.memory, 0).Compilable()
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected, "Memory:", test.memory)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	memory := []uint16{uint16(opNoop), uint16(opOut), 'a', 99, uint16(opHalt)}
+
+	expected := []uint16{0, 1, 3, 4}
+	result := Disassemble(memory)
+	if len(result) != len(expected) {
+		t.Fatal("Got:", result, "Expected:", expected)
+	}
+	for i := range expected {
+		if result[i].Address != expected[i] {
+			t.Error("Got:", result[i].Address, "Expected:", expected[i])
+		}
+	}
+}
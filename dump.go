@@ -0,0 +1,191 @@
+package synacor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DumpFormat is how memory is written by Dump.
+type DumpFormat int
+
+// Formats memory can be dumped in.
+const (
+	// DumpRaw is a binary the Machine can load
+	DumpRaw DumpFormat = iota
+	// DumpHex is each word in hex alongside the characters they'd print
+	DumpHex
+	// DumpDisassembly is memory decoded as instructions
+	DumpDisassembly
+)
+
+var dumpFormats = map[string]DumpFormat{
+	"raw":  DumpRaw,
+	"hex":  DumpHex,
+	"dasm": DumpDisassembly,
+}
+
+// Words per line of a hex dump.
+const hexWidth = 8
+
+// ParseDumpFormat returns the format named raw, hex or dasm.
+func ParseDumpFormat(s string) (DumpFormat, error) {
+	f, ok := dumpFormats[s]
+	if !ok {
+		return DumpRaw, fmt.Errorf("unknown dump format %q, expected raw, hex or dasm", s)
+	}
+	return f, nil
+}
+
+// Dump writes the Machine's memory as it is right now.
+func (m Machine) Dump(w io.Writer, f DumpFormat) error {
+	switch f {
+	case DumpHex:
+		return WriteHex(w, m.Program.memory)
+	case DumpDisassembly:
+		return WriteDisassembly(w, m.Program.memory, m.Program.symbols, m.PC())
+	}
+	return m.WriteImage(w)
+}
+
+// WriteHex writes memory as lines of an address, the words in hex and the
+// characters they'd print.
+func WriteHex(w io.Writer, memory []uint16) error {
+	bw := bufio.NewWriter(w)
+
+	for a := 0; a < len(memory); a += hexWidth {
+		end := a + hexWidth
+		if end > len(memory) {
+			end = len(memory)
+		}
+
+		var chars strings.Builder
+		fmt.Fprintf(bw, "%5d:", a)
+		for _, word := range memory[a:end] {
+			fmt.Fprintf(bw, " %04x", word)
+			if word >= ' ' && word <= '~' {
+				chars.WriteRune(rune(word))
+			} else {
+				chars.WriteRune('.')
+			}
+		}
+		fmt.Fprintf(bw, "%s  %s\n", strings.Repeat("     ", hexWidth-(end-a)), chars.String())
+	}
+	return bw.Flush()
+}
+
+// WriteDisassembly writes memory decoded as instructions, one after another
+// from the start, with symbols (which can be nil) naming addresses.  The
+// instruction at pc is marked; pass -1 to mark nothing.
+func WriteDisassembly(w io.Writer, memory []uint16, symbols *Symbols, pc int) error {
+	_, err := writeDisassembly(w, memory, symbols, pc)
+	return err
+}
+
+// WriteListing writes memory decoded as instructions, like WriteDisassembly,
+// and returns which line each instruction is on.
+func WriteListing(w io.Writer, memory []uint16, symbols *Symbols) (SourceMap, error) {
+	return writeDisassembly(w, memory, symbols, -1)
+}
+
+func writeDisassembly(w io.Writer, memory []uint16, symbols *Symbols, pc int) (SourceMap, error) {
+	bw := bufio.NewWriter(w)
+	lines := SourceMap{}
+	line := 1
+
+	for _, i := range Disassemble(memory) {
+		if sym, ok := symbols.Lookup(i.Address); ok {
+			fmt.Fprintf(bw, "\n%s: ; %s %s\n", sym.Name, sym.Type, sym.Comment)
+			line += 2
+		}
+
+		marker := "  "
+		if int(i.Address) == pc {
+			marker = "=>"
+		}
+		fmt.Fprintf(bw, "%s %5d  %s\n", marker, i.Address, i.Format(symbols))
+		lines.add(i.Address, line)
+		line++
+	}
+	return lines, bw.Flush()
+}
+
+// ReadImage reads a binary of little endian words.
+func ReadImage(r io.Reader) ([]uint16, error) {
+	reader := bufio.NewReader(r)
+	memory := []uint16{}
+
+	for {
+		le, err := readNext(reader)
+		if err == io.EOF {
+			return memory, nil
+		}
+		if err != nil {
+			return memory, err
+		}
+		memory = append(memory, le)
+	}
+}
+
+// Range is a run of addresses, from Start up to but not including End.
+type Range struct {
+	Start, End int
+}
+
+// Diff returns the ranges of addresses where two memory images differ.  If one
+// is longer, the addresses past the end of the other differ.
+func Diff(a, b []uint16) []Range {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+
+	ranges := []Range{}
+	for i := 0; i < n; i++ {
+		if i < len(a) && i < len(b) && a[i] == b[i] {
+			continue
+		}
+
+		if len(ranges) > 0 && ranges[len(ranges)-1].End == i {
+			ranges[len(ranges)-1].End++
+		} else {
+			ranges = append(ranges, Range{i, i + 1})
+		}
+	}
+	return ranges
+}
+
+// WriteDiff writes the ranges of addresses that differ between two memory
+// images, with the instructions there before and after.
+func WriteDiff(w io.Writer, before, after []uint16, symbols *Symbols) error {
+	bw := bufio.NewWriter(w)
+
+	ranges := Diff(before, after)
+	if len(ranges) == 0 {
+		fmt.Fprintln(bw, "No differences")
+		return bw.Flush()
+	}
+
+	sides := []struct {
+		name         string
+		instructions []Instruction
+	}{
+		{"before", Disassemble(before)},
+		{"after", Disassemble(after)},
+	}
+
+	for _, r := range ranges {
+		fmt.Fprintf(bw, "%s-%d (%d words)\n", symbols.Name(uint16(r.Start)), r.End-1, r.End-r.Start)
+
+		for _, side := range sides {
+			fmt.Fprintf(bw, "  %s:\n", side.name)
+			for _, i := range side.instructions {
+				if int(i.Address) < r.End && int(i.Address)+i.Size() > r.Start {
+					fmt.Fprintf(bw, "    %5d  %s\n", i.Address, i.Format(symbols))
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
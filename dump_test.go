@@ -0,0 +1,129 @@
+package synacor
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseDumpFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected DumpFormat
+		err      bool
+	}{
+		{"raw", DumpRaw, false},
+		{"hex", DumpHex, false},
+		{"dasm", DumpDisassembly, false},
+		{"pdf", DumpRaw, true},
+	}
+
+	for _, test := range tests {
+		f, err := ParseDumpFormat(test.name)
+		if f != test.expected || (err != nil) != test.err {
+			t.Error("Got:", f, err, "Expected:", test.expected, test.err)
+		}
+	}
+}
+
+func TestMachineDump(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 3, Type: Label, Name: "done", Comment: "all done"})
+
+	m := newTestMachine([]uint16{uint16(opOut), 'T', uint16(opNoop), uint16(opHalt), 0, 1, 2, 3, 4})
+	m.SetSymbols(s)
+	m.Step()
+
+	tests := []struct {
+		format   DumpFormat
+		expected string
+	}{
+		{DumpRaw, "\x13\x00T\x00\x15\x00\x00\x00\x00\x00\x01\x00\x02\x00\x03\x00\x04\x00"},
+		{DumpHex, "    0: 0013 0054 0015 0000 0000 0001 0002 0003  .T......\n    8: 0004                                     .\n"},
+		{DumpDisassembly, "       0  out 'T'\n=>     2  noop\n\ndone: ; label all done\n       3  halt\n       4  halt\n       5  set 2 3\n       8  data 4\n"},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := m.Dump(&b, test.format); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.expected {
+			t.Errorf("Got: %q Expected: %q", b.String(), test.expected)
+		}
+	}
+}
+
+func TestReadImage(t *testing.T) {
+	memory, err := ReadImage(bytes.NewReader([]byte{19, 0, 84, 0}))
+	if err != nil || len(memory) != 2 || memory[0] != 19 || memory[1] != 84 {
+		t.Error("Got:", memory, err, "Expected:", []uint16{19, 84})
+	}
+
+	if _, err := ReadImage(bytes.NewReader([]byte{19, 0, 84})); err == nil {
+		t.Error("Expected an error for an odd number of bytes")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b     []uint16
+		expected []Range
+	}{
+		{[]uint16{1, 2, 3}, []uint16{1, 2, 3}, []Range{}},
+		{[]uint16{1, 2, 3, 4}, []uint16{0, 2, 0, 0}, []Range{{0, 1}, {2, 4}}},
+		{[]uint16{1, 2}, []uint16{1, 2, 3, 4}, []Range{{2, 4}}},
+		{[]uint16{1, 2, 3}, []uint16{1}, []Range{{1, 3}}},
+	}
+
+	for _, test := range tests {
+		result := Diff(test.a, test.b)
+		if len(result) != len(test.expected) {
+			t.Error("Got:", result, "Expected:", test.expected)
+			continue
+		}
+		for i := range result {
+			if result[i] != test.expected[i] {
+				t.Error("Got:", result[i], "Expected:", test.expected[i])
+			}
+		}
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	tests := []struct {
+		before, after []uint16
+		expected      string
+	}{
+		{
+			[]uint16{17, 6, 21, 19, 65, 0},
+			[]uint16{21, 21, 21, 19, 66, 0, 7},
+			`0-1 (2 words)
+  before:
+        0  call 6
+  after:
+        0  noop
+        1  noop
+4-4 (1 words)
+  before:
+        3  out 'A'
+  after:
+        3  out 'B'
+6-6 (1 words)
+  before:
+  after:
+        6  data 7
+`,
+		},
+		{[]uint16{1, 2}, []uint16{1, 2}, "No differences\n"},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := WriteDiff(&b, test.before, test.after, nil); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.expected {
+			t.Error("Got:", b.String(), "Expected:", test.expected)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package synacor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expression is a value worked out from the state of a Machine, for
+// conditional breakpoints, watchpoints and log points.
+type Expression struct {
+	src  string
+	eval evaluator
+}
+
+type evaluator func(m Machine) (int, error)
+
+// ParseExpression parses an expression over a Machine's state.  It has Go's
+// operators and precedence (comparisons and ! give 1 or 0, anything but 0 is
+// true) over:
+//
+//	r0 to r7    registers
+//	pc          the address of the next instruction
+//	steps       instructions executed
+//	mem[e]      the word at address e
+//	stack[e]    the value e from the top of the stack
+//	top         the top of the stack, stack[0]
+//	depth       how deep the stack is
+//
+// numbers (6027, 0x178b), characters ('a') and names from symbols (which can
+// be nil).
+func ParseExpression(src string, symbols *Symbols) (Expression, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	p := &exprParser{tokens: tokens, symbols: symbols}
+	eval, err := p.parse(0)
+	if err != nil {
+		return Expression{}, err
+	}
+	if !p.done() {
+		return Expression{}, fmt.Errorf("unexpected %q in %q", p.peek(), src)
+	}
+	return Expression{strings.TrimSpace(src), eval}, nil
+}
+
+// Eval works out the expression's value.  It's an error to divide by zero or
+// look past the end of memory or the bottom of the stack.
+func (e Expression) Eval(m Machine) (int, error) {
+	if e.eval == nil {
+		return 0, fmt.Errorf("empty expression")
+	}
+	return e.eval(m)
+}
+
+// String returns the expression as it was parsed.
+func (e Expression) String() string {
+	return e.src
+}
+
+// Binary operators by precedence, highest last, as in Go.
+var binaryOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-", "|", "^"},
+	{"*", "/", "%", "<<", ">>", "&"},
+}
+
+// Tokens made of several characters, matched before single characters.
+var longTokens = []string{"||", "&&", "==", "!=", "<=", ">=", "<<", ">>"}
+
+// lex splits an expression into numbers, characters, names and operators.
+func lex(src string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c == '\'':
+			end := i + 1
+			for end < len(src) && src[end] != '\'' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated character in %q", src)
+			}
+			tokens = append(tokens, src[i:end+1])
+			i = end + 1
+			continue
+		case isWordChar(c):
+			end := i
+			for end < len(src) && isWordChar(src[end]) {
+				end++
+			}
+			tokens = append(tokens, src[i:end])
+			i = end
+			continue
+		}
+
+		token := ""
+		for _, t := range longTokens {
+			if strings.HasPrefix(src[i:], t) {
+				token = t
+			}
+		}
+		if token == "" {
+			if !strings.ContainsRune("+-*/%&|^!<>()[]", rune(c)) {
+				return nil, fmt.Errorf("unexpected %q in %q", c, src)
+			}
+			token = string(c)
+		}
+		tokens = append(tokens, token)
+		i += len(token)
+	}
+	return tokens, nil
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+type exprParser struct {
+	tokens  []string
+	symbols *Symbols
+}
+
+func (p *exprParser) done() bool {
+	return len(p.tokens) == 0
+}
+
+func (p *exprParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	if !p.done() {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+func (p *exprParser) expect(token string) error {
+	if t := p.next(); t != token {
+		if t == "" {
+			t = "end of expression"
+		}
+		return fmt.Errorf("expected %q, got %q", token, t)
+	}
+	return nil
+}
+
+// parse parses binary operators of a precedence level and higher.
+func (p *exprParser) parse(level int) (evaluator, error) {
+	if level == len(binaryOperators) {
+		return p.unary()
+	}
+
+	left, err := p.parse(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for contains(binaryOperators[level], p.peek()) {
+		op := p.next()
+		right, err := p.parse(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = operate(op, left, right)
+	}
+	return left, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) unary() (evaluator, error) {
+	switch op := p.peek(); op {
+	case "-", "!", "^":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(m Machine) (int, error) {
+			v, err := operand(m)
+			switch op {
+			case "-":
+				v = -v
+			case "!":
+				v = truth(v == 0)
+			default:
+				v = ^v
+			}
+			return v, err
+		}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (evaluator, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("expression ends early")
+	case t == "(":
+		e, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case t == "mem" || t == "stack":
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		index, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		if t == "mem" {
+			return memoryAt(index), p.expect("]")
+		}
+		return stackAt(index), p.expect("]")
+	case t == "top":
+		return stackAt(constant(0)), nil
+	case t == "depth":
+		return func(m Machine) (int, error) { return len(*m.Stack), nil }, nil
+	case t == "pc":
+		return func(m Machine) (int, error) { return m.PC(), nil }, nil
+	case t == "steps":
+		return func(m Machine) (int, error) { return int(m.Steps()), nil }, nil
+	case len(t) == 2 && t[0] == 'r' && t[1] >= '0' && t[1] <= '7':
+		n := int(t[1] - '0')
+		return func(m Machine) (int, error) { return int(m.Register(n)), nil }, nil
+	case t[0] == '\'':
+		c, err := strconv.Unquote(t)
+		if err != nil || len([]rune(c)) != 1 {
+			return nil, fmt.Errorf("bad character %s", t)
+		}
+		return constant(int([]rune(c)[0])), nil
+	case t[0] >= '0' && t[0] <= '9':
+		n, err := strconv.ParseInt(t, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", t)
+		}
+		return constant(int(n)), nil
+	}
+
+	sym, ok := p.symbols.byName(t)
+	if !ok {
+		return nil, fmt.Errorf("unknown name %q", t)
+	}
+	return constant(int(sym.Address)), nil
+}
+
+func constant(v int) evaluator {
+	return func(Machine) (int, error) { return v, nil }
+}
+
+func memoryAt(index evaluator) evaluator {
+	return func(m Machine) (int, error) {
+		a, err := index(m)
+		if err != nil {
+			return 0, err
+		}
+		if a < 0 || a >= len(m.Program.memory) {
+			return 0, fmt.Errorf("mem[%d] is past the end of memory", a)
+		}
+		return int(m.Memory(uint16(a))), nil
+	}
+}
+
+// stackAt counts down from the top of the stack.
+func stackAt(index evaluator) evaluator {
+	return func(m Machine) (int, error) {
+		n, err := index(m)
+		if err != nil {
+			return 0, err
+		}
+		s := *m.Stack
+		if n < 0 || n >= len(s) {
+			return 0, fmt.Errorf("stack[%d] is past the bottom of the stack, %d deep", n, len(s))
+		}
+		return int(s[len(s)-1-n]), nil
+	}
+}
+
+func operate(op string, left, right evaluator) evaluator {
+	return func(m Machine) (int, error) {
+		a, err := left(m)
+		if err != nil {
+			return 0, err
+		}
+		// && and || only work out the right when they need to
+		switch {
+		case op == "&&" && a == 0:
+			return 0, nil
+		case op == "||" && a != 0:
+			return 1, nil
+		}
+		b, err := right(m)
+		if err != nil {
+			return 0, err
+		}
+
+		switch op {
+		case "||", "&&":
+			return truth(b != 0), nil
+		case "==":
+			return truth(a == b), nil
+		case "!=":
+			return truth(a != b), nil
+		case "<":
+			return truth(a < b), nil
+		case "<=":
+			return truth(a <= b), nil
+		case ">":
+			return truth(a > b), nil
+		case ">=":
+			return truth(a >= b), nil
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "|":
+			return a | b, nil
+		case "^":
+			return a ^ b, nil
+		case "*":
+			return a * b, nil
+		case "&":
+			return a & b, nil
+		case "<<", ">>":
+			if b < 0 || b > 32 {
+				return 0, fmt.Errorf("bad shift %d", b)
+			}
+			if op == "<<" {
+				return a << uint(b), nil
+			}
+			return a >> uint(b), nil
+		}
+
+		if b == 0 {
+			return 0, fmt.Errorf("%s by zero", op)
+		}
+		if op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	}
+}
+
+func truth(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package synacor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpressionEval(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 6027, Type: Function, Name: "confirm_teleporter"})
+
+	m := newTestMachine([]uint16{uint16(opNoop), uint16(opNoop), 42, 7})
+	m.Step()
+	m.SetRegister(0, 3)
+	m.SetRegister(7, 25734)
+	m.SetStack([]uint16{10, 20, 30})
+
+	tests := []struct {
+		expression string
+		expected   int
+	}{
+		{"r7", 25734},
+		{"r7 != 0", 1},
+		{"r0 == 3 && r7 == 0", 0},
+		{"r0 == 4 || r7 == 25734", 1},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"r0 << 2 | 1", 13},
+		{"r0 & 1 == 1", 1},
+		{"-r0 + 10 % 4", -1},
+		{"!r0", 0},
+		{"^0", -1},
+		{"mem[2] + mem[pc + 2]", 49},
+		{"mem[mem[3] - 5]", 42},
+		{"top", 30},
+		{"stack[2]", 10},
+		{"depth", 3},
+		{"pc", 1},
+		{"steps", 1},
+		{"0x178b", 6027},
+		{"'a'", 97},
+		{"'\\n'", 10},
+		{"confirm_teleporter + 22", 6049},
+		{"1 < 2 == 1", 1},
+		{"3 >= 3 && 2 <= 1", 0},
+	}
+
+	for _, test := range tests {
+		e, err := ParseExpression(test.expression, s)
+		if err != nil {
+			t.Error("Got:", err, "Expected:", test.expected, "For:", test.expression)
+			continue
+		}
+		result, err := e.Eval(m)
+		if err != nil || result != test.expected {
+			t.Error("Got:", result, err, "Expected:", test.expected, "For:", test.expression)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"", "ends early"},
+		{"r8", "unknown name"},
+		{"r0 +", "ends early"},
+		{"(r0", "expected \")\""},
+		{"mem 3", "expected \"[\""},
+		{"r0 r1", "unexpected \"r1\""},
+		{"r0 = 1", "unexpected '='"},
+		{"'a", "unterminated"},
+		{"'ab'", "bad character"},
+		{"99999999999", "bad number"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseExpression(test.expression, nil)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Error("Got:", err, "Expected:", test.want, "For:", test.expression)
+		}
+	}
+}
+
+func TestExpressionEvalErrors(t *testing.T) {
+	m := newTestMachine([]uint16{uint16(opHalt)})
+
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"1 / r0", "/ by zero"},
+		{"1 % 0", "% by zero"},
+		{"mem[1]", "past the end of memory"},
+		{"mem[-1]", "past the end of memory"},
+		{"top", "past the bottom of the stack"},
+		{"1 << 40", "bad shift"},
+		// the right of && isn't worked out when the left is false
+		{"0 && top", ""},
+	}
+
+	for _, test := range tests {
+		e, err := ParseExpression(test.expression, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = e.Eval(m)
+		if (test.want == "") != (err == nil) || err != nil && !strings.Contains(err.Error(), test.want) {
+			t.Error("Got:", err, "Expected:", test.want, "For:", test.expression)
+		}
+	}
+
+	if _, err := (Expression{}).Eval(m); err == nil {
+		t.Error("Got:", err, "Expected: an error for an empty expression")
+	}
+}
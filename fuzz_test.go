@@ -0,0 +1,219 @@
+package synacor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// How many instructions a fuzzed program may take.
+const fuzzSteps = 1000
+
+// image returns memory as the bytes of a binary.
+func image(memory []uint16) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, memory)
+	return b.Bytes()
+}
+
+// addPrograms adds the conformance programs to a fuzz target's corpus.
+func addPrograms(f *testing.F) {
+	for _, c := range conformanceCases {
+		program, err := Assemble(c.src, 0, nil)
+		if err != nil {
+			f.Fatal("Got:", err, "Expected:", nil)
+		}
+		f.Add(image(program))
+	}
+}
+
+// FuzzLoad loads random binaries and runs them for a while; they load or
+// return an error, and run or fault, but never panic.
+func FuzzLoad(f *testing.F) {
+	addPrograms(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file := filepath.Join(t.TempDir(), "fuzz.bin")
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		m := newTestMachine(nil)
+		raw := !IsContainer(data)
+		if err := m.Load(file); err != nil {
+			// containers can be broken any number of ways; raw images only one
+			if raw && len(data)%2 == 0 && len(data) <= 2*(maxMemory+1) {
+				t.Error("Got:", err, "Expected:", nil)
+			}
+			return
+		}
+		if raw && len(m.Image()) != len(data)/2 {
+			t.Error("Got:", len(m.Image()), "Expected:", len(data)/2)
+		}
+
+		m.SetOutput(ioutil.Discard)
+		m.SetInput(strings.NewReader("look\n"))
+		stop := m.RunSteps(fuzzSteps)
+
+		if (stop == Faulted) != (m.Fault() != nil) {
+			t.Error("Got:", m.Fault(), "Expected a fault when stopped by one, stopped:", stop)
+		}
+	})
+}
+
+// FuzzNextOp decodes random memory one operation after another.
+func FuzzNextOp(f *testing.F) {
+	addPrograms(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		memory, _ := ReadImage(bytes.NewReader(data))
+		if len(memory) > maxMemory+1 {
+			return
+		}
+		m := newTestMachine(memory)
+
+		for m.HasMoreOps() {
+			pc := m.PC()
+			name, code, args := m.NextOp()
+
+			if m.PC() <= pc {
+				t.Fatal("Got:", m.PC(), "Expected more than:", pc)
+			}
+			if code != memory[pc] {
+				t.Error("Got:", code, "Expected:", memory[pc], "At:", pc)
+			}
+			if name != "" && len(args) != operatorPropertyMap[opcode(code)].args {
+				t.Error("Got:", len(args), "Expected:", operatorPropertyMap[opcode(code)].args, "At:", pc)
+			}
+		}
+	})
+}
+
+// FuzzStep executes a single random instruction with random registers, stack
+// and input.  It either runs or faults, leaving the index where it was.
+func FuzzStep(f *testing.F) {
+	for oc := range operatorPropertyMap {
+		f.Add(uint16(oc), uint16(register0), uint16(2), uint16(register1), uint16(7), true, "a")
+	}
+	f.Add(uint16(22), uint16(0), uint16(0), uint16(0), uint16(0), false, "")
+	f.Add(uint16(opMod), uint16(register0), uint16(1), uint16(0), uint16(0), false, "")
+	f.Add(uint16(opRmem), uint16(register0), uint16(30000), uint16(0), uint16(0), false, "")
+	f.Add(uint16(opWmem), uint16(30000), uint16(5), uint16(0), uint16(0), false, "")
+
+	f.Fuzz(func(t *testing.T, op, a, b, c, value uint16, stacked bool, input string) {
+		m := newTestMachine([]uint16{op, a, b, c})
+		for n := 0; n < 8; n++ {
+			m.SetRegister(n, (value+uint16(n))%modulo)
+		}
+		if stacked {
+			m.Stack.push(value)
+		}
+		m.SetOutput(ioutil.Discard)
+		m.SetInput(strings.NewReader(input))
+
+		m.Step()
+
+		switch m.Stopped() {
+		case Faulted:
+			if m.PC() != 0 {
+				t.Error("Got:", m.PC(), "Expected:", 0)
+			}
+			if m.Steps() != 0 {
+				t.Error("Got:", m.Steps(), "Expected:", 0)
+			}
+		case NotStopped, EndOfProgram:
+			if m.Steps() != 1 {
+				t.Error("Got:", m.Steps(), "Expected:", 1)
+			}
+		}
+
+		for n := 0; n < 8; n++ {
+			if !isLiteralValue(m.Register(n)) {
+				t.Error("Got:", m.Register(n), "Expected a number in r", n)
+			}
+		}
+	})
+}
+
+func TestMachineLoadErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "synacor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"odd length", []byte{19, 0, 65}},
+		{"too big", make([]byte, 2*(maxMemory+2))},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(file, test.data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		m := newTestMachine(nil)
+		if err := m.Load(file); err == nil {
+			t.Error("Got:", err, "Expected an error for:", test.name)
+		}
+	}
+
+	m := newTestMachine(nil)
+	if err := m.Load(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Got:", err, "Expected an error for a missing file")
+	}
+}
+
+func TestMachineStepFaults(t *testing.T) {
+	tests := []struct {
+		memory []uint16
+		reason string
+	}{
+		{[]uint16{22}, "unknown opcode 22"},
+		{[]uint16{256 + uint16(opOut), 'x'}, "unknown opcode 275"},
+		{[]uint16{uint16(opAdd), register0, 1}, "operands run past the end of memory"},
+		{[]uint16{uint16(opOut), 40000}, "invalid operand 40000"},
+		{[]uint16{uint16(opSet), 3, 1}, "3 is not a register"},
+		{[]uint16{uint16(opMod), register0, 1, 0}, "mod by zero"},
+		{[]uint16{uint16(opRmem), register0, 4, uint16(opHalt), 32768 + 5}, "32773 is not a number"},
+	}
+
+	for _, test := range tests {
+		m := newTestMachine(test.memory)
+		m.Step()
+
+		if m.Stopped() != Faulted {
+			t.Error("Got:", m.Stopped(), "Expected:", Faulted, "For:", test.memory)
+			continue
+		}
+		if m.Fault().Reason != test.reason {
+			t.Error("Got:", m.Fault().Reason, "Expected:", test.reason)
+		}
+		if m.PC() != 0 {
+			t.Error("Got:", m.PC(), "Expected:", 0)
+		}
+	}
+}
+
+func TestMachineMemoryPastImage(t *testing.T) {
+	m := newTestMachine([]uint16{uint16(opWmem), 100, 42, uint16(opRmem), register0, 200})
+	m.RunSteps(2)
+
+	if m.Memory(100) != 42 {
+		t.Error("Got:", m.Memory(100), "Expected:", 42)
+	}
+	if m.Register(0) != 0 {
+		t.Error("Got:", m.Register(0), "Expected:", 0)
+	}
+	if m.Memory(maxMemory) != 0 {
+		t.Error("Got:", m.Memory(maxMemory), "Expected:", 0)
+	}
+}
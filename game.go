@@ -0,0 +1,289 @@
+package synacor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Layout is where the game keeps its rooms and items in memory.  Strings and
+// lists in the game are stored as their length followed by their elements,
+// and fields are pointers to them.
+type Layout struct {
+	// CurrentRoom is the address holding the address of the room the player
+	// is in
+	CurrentRoom uint16     `json:"current_room"`
+	Room        RoomLayout `json:"room"`
+	Items       ItemLayout `json:"items"`
+}
+
+// RoomLayout is the offsets of the fields of a room.
+type RoomLayout struct {
+	Name        int `json:"name"`
+	Description int `json:"description"`
+	// ExitNames points to a list of pointers to the names of the exits
+	ExitNames int `json:"exit_names"`
+	// ExitRooms points to a list of the rooms the exits lead to, in the same
+	// order as their names
+	ExitRooms int `json:"exit_rooms"`
+}
+
+// ItemLayout is where the table of items is and the offsets of an item's
+// fields.
+type ItemLayout struct {
+	Start uint16 `json:"start"`
+	Count int    `json:"count"`
+	// Size of an item in words
+	Size        int `json:"size"`
+	Name        int `json:"name"`
+	Description int `json:"description"`
+	// Location is the address of the room the item is in, or Inventory
+	Location int `json:"location"`
+	// Inventory is the location of items the player is carrying
+	Inventory uint16 `json:"inventory"`
+}
+
+// Room is a room read from memory.
+type Room struct {
+	Address     uint16
+	Name        string
+	Description string
+	Exits       []Exit
+}
+
+// Exit is a way out of a room.
+type Exit struct {
+	Name string
+	Room uint16
+}
+
+// Item is an item read from memory.
+type Item struct {
+	Address     uint16
+	Name        string
+	Description string
+	Location    uint16
+}
+
+// LoadLayout reads a layout from a JSON file.
+func LoadLayout(file string) (Layout, error) {
+	var l Layout
+
+	fh, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return l, err
+	}
+	defer fh.Close()
+
+	dec := json.NewDecoder(fh)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&l); err != nil {
+		return l, fmt.Errorf("%s: %v", file, err)
+	}
+	return l, nil
+}
+
+// Game reads and changes the state of the game in a Machine's memory.
+type Game struct {
+	m      Machine
+	layout Layout
+}
+
+// NewGame returns a Game reading m's memory with layout.
+func NewGame(m Machine, layout Layout) Game {
+	return Game{m, layout}
+}
+
+// CurrentRoom returns the room the player is in.
+func (g Game) CurrentRoom() (Room, error) {
+	return g.Room(g.m.Memory(g.layout.CurrentRoom))
+}
+
+// Room reads the room at an address.
+func (g Game) Room(address uint16) (Room, error) {
+	l := g.layout.Room
+	r := Room{Address: address}
+
+	var err error
+	if r.Name, err = g.stringAt(g.field(address, l.Name)); err != nil {
+		return r, fmt.Errorf("no room at %d: %v", address, err)
+	}
+	if r.Description, err = g.stringAt(g.field(address, l.Description)); err != nil {
+		return r, fmt.Errorf("room %d: %v", address, err)
+	}
+
+	names, err := g.list(g.field(address, l.ExitNames))
+	if err != nil {
+		return r, fmt.Errorf("room %d exits: %v", address, err)
+	}
+	rooms, err := g.list(g.field(address, l.ExitRooms))
+	if err != nil {
+		return r, fmt.Errorf("room %d exits: %v", address, err)
+	}
+	if len(names) != len(rooms) {
+		return r, fmt.Errorf("room %d has %d exit names and %d exits", address, len(names), len(rooms))
+	}
+
+	for i, name := range names {
+		s, err := g.text(name)
+		if err != nil {
+			return r, fmt.Errorf("room %d exit %d: %v", address, i, err)
+		}
+		r.Exits = append(r.Exits, Exit{s, rooms[i]})
+	}
+	return r, nil
+}
+
+// Rooms returns every room that can be reached from the current room, in the
+// order they're found.
+func (g Game) Rooms() ([]Room, error) {
+	start, err := g.CurrentRoom()
+	if err != nil {
+		return nil, err
+	}
+
+	rooms := []Room{start}
+	seen := map[uint16]bool{start.Address: true}
+	for i := 0; i < len(rooms); i++ {
+		for _, e := range rooms[i].Exits {
+			if seen[e.Room] {
+				continue
+			}
+			seen[e.Room] = true
+
+			r, err := g.Room(e.Room)
+			if err != nil {
+				return rooms, err
+			}
+			rooms = append(rooms, r)
+		}
+	}
+	return rooms, nil
+}
+
+// Items returns every item in the item table.
+func (g Game) Items() ([]Item, error) {
+	l := g.layout.Items
+	items := []Item{}
+
+	for n := 0; n < l.Count; n++ {
+		address := l.Start + uint16(n*l.Size)
+		i := Item{Address: address, Location: g.m.Memory(g.field(address, l.Location))}
+
+		var err error
+		if i.Name, err = g.stringAt(g.field(address, l.Name)); err != nil {
+			return items, fmt.Errorf("item %d: %v", address, err)
+		}
+		if i.Description, err = g.stringAt(g.field(address, l.Description)); err != nil {
+			return items, fmt.Errorf("item %d: %v", address, err)
+		}
+		items = append(items, i)
+	}
+	return items, nil
+}
+
+// Inventory returns the items the player is carrying.
+func (g Game) Inventory() ([]Item, error) {
+	items, err := g.Items()
+	if err != nil {
+		return nil, err
+	}
+
+	carried := []Item{}
+	for _, i := range items {
+		if g.Carried(i) {
+			carried = append(carried, i)
+		}
+	}
+	return carried, nil
+}
+
+// Carried returns true if the player is carrying an item.
+func (g Game) Carried(i Item) bool {
+	return i.Location == g.layout.Items.Inventory
+}
+
+// Item returns the item with a name, ignoring case.
+func (g Game) Item(name string) (Item, error) {
+	items, err := g.Items()
+	if err != nil {
+		return Item{}, err
+	}
+
+	for _, i := range items {
+		if strings.EqualFold(i.Name, name) {
+			return i, nil
+		}
+	}
+	return Item{}, fmt.Errorf("no item called %q", name)
+}
+
+// Teleport moves the player to the room at an address.
+func (g Game) Teleport(room uint16) error {
+	if _, err := g.Room(room); err != nil {
+		return err
+	}
+	g.m.SetMemory(g.layout.CurrentRoom, room)
+	return nil
+}
+
+// MoveItem puts the item with a name in the room at an address.
+func (g Game) MoveItem(name string, room uint16) error {
+	i, err := g.Item(name)
+	if err != nil {
+		return err
+	}
+	if _, err := g.Room(room); err != nil {
+		return err
+	}
+
+	g.m.SetMemory(g.field(i.Address, g.layout.Items.Location), room)
+	return nil
+}
+
+// Take puts the item with a name in the player's inventory.
+func (g Game) Take(name string) error {
+	i, err := g.Item(name)
+	if err != nil {
+		return err
+	}
+
+	g.m.SetMemory(g.field(i.Address, g.layout.Items.Location), g.layout.Items.Inventory)
+	return nil
+}
+
+// field returns the address of a field of the struct at address; past the end
+// of memory is left to the reads to catch.
+func (g Game) field(address uint16, offset int) uint16 {
+	return address + uint16(offset)
+}
+
+// stringAt reads the length prefixed string the word at address points to.
+func (g Game) stringAt(address uint16) (string, error) {
+	return g.text(g.m.Memory(address))
+}
+
+// text reads the length prefixed string at address.
+func (g Game) text(address uint16) (string, error) {
+	memory := g.m.Program.memory
+	if int(address) < len(memory) {
+		if s, ok := prefixedString(memory, int(address), 0); ok {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("no string at %d", address)
+}
+
+// list reads the length prefixed list the word at address points to.
+func (g Game) list(address uint16) ([]uint16, error) {
+	pointer := int(g.m.Memory(address))
+	memory := g.m.Program.memory
+
+	if pointer >= len(memory) || pointer+int(memory[pointer]) >= len(memory) {
+		return nil, fmt.Errorf("no list at %d", pointer)
+	}
+	n := int(memory[pointer])
+	return append([]uint16(nil), memory[pointer+1:pointer+1+n]...), nil
+}
@@ -0,0 +1,205 @@
+package synacor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gameMemory builds the memory of a tiny game.
+type gameMemory []uint16
+
+func (g *gameMemory) put(words ...uint16) uint16 {
+	a := uint16(len(*g))
+	*g = append(*g, words...)
+	return a
+}
+
+func (g *gameMemory) str(s string) uint16 {
+	words := []uint16{uint16(len(s))}
+	for _, c := range s {
+		words = append(words, uint16(c))
+	}
+	return g.put(words...)
+}
+
+var testLayout = Layout{
+	CurrentRoom: 0,
+	Room:        RoomLayout{Name: 0, Description: 1, ExitNames: 2, ExitRooms: 3},
+	Items:       ItemLayout{Start: 11, Count: 2, Size: 4, Name: 0, Description: 1, Location: 2, Inventory: 0},
+}
+
+// testGame returns a game with a hall and a closet, a lamp in the closet and
+// a key the player carries.
+func testGame() Game {
+	// current room, two rooms of 5 words and two items of 4 words
+	g := make(gameMemory, 1+5+5+4+4)
+	const hall, closet, lamp, key = 1, 6, 11, 15
+	g[0] = hall
+
+	rooms := []struct {
+		address           uint16
+		name, description string
+		exit              string
+		to                uint16
+	}{
+		{hall, "Hall", "A long hall.", "north", closet},
+		{closet, "Closet", "It's cramped.", "south", hall},
+	}
+	// g grows as strings are added, so fields are set after adding them
+	for _, r := range rooms {
+		name, description, exit := g.str(r.name), g.str(r.description), g.str(r.exit)
+		exits, to := g.put(1, exit), g.put(1, r.to)
+		copy(g[r.address:], []uint16{name, description, exits, to})
+	}
+
+	items := []struct {
+		address           uint16
+		name, description string
+		location          uint16
+	}{
+		{lamp, "lamp", "A brass lamp.", closet},
+		{key, "key", "A small key.", 0},
+	}
+	for _, i := range items {
+		name, description := g.str(i.name), g.str(i.description)
+		copy(g[i.address:], []uint16{name, description, i.location})
+	}
+
+	return NewGame(newTestMachine(g), testLayout)
+}
+
+func TestGameCurrentRoom(t *testing.T) {
+	room, err := testGame().CurrentRoom()
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	expected := Room{1, "Hall", "A long hall.", []Exit{{"north", 6}}}
+	if !reflect.DeepEqual(room, expected) {
+		t.Error("Got:", room, "Expected:", expected)
+	}
+}
+
+func TestGameRooms(t *testing.T) {
+	rooms, err := testGame().Rooms()
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	names := []string{}
+	for _, r := range rooms {
+		names = append(names, r.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Hall", "Closet"}) {
+		t.Error("Got:", names, "Expected:", []string{"Hall", "Closet"})
+	}
+}
+
+func TestGameItems(t *testing.T) {
+	g := testGame()
+
+	items, err := g.Items()
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	expected := []Item{{11, "lamp", "A brass lamp.", 6}, {15, "key", "A small key.", 0}}
+	if !reflect.DeepEqual(items, expected) {
+		t.Error("Got:", items, "Expected:", expected)
+	}
+
+	inventory, err := g.Inventory()
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if !reflect.DeepEqual(inventory, expected[1:]) {
+		t.Error("Got:", inventory, "Expected:", expected[1:])
+	}
+}
+
+func TestGameEdits(t *testing.T) {
+	g := testGame()
+
+	if err := g.Teleport(6); err != nil {
+		t.Error("Got:", err, "Expected:", nil)
+	}
+	if room, _ := g.CurrentRoom(); room.Name != "Closet" {
+		t.Error("Got:", room.Name, "Expected:", "Closet")
+	}
+
+	if err := g.Take("LAMP"); err != nil {
+		t.Error("Got:", err, "Expected:", nil)
+	}
+	if err := g.MoveItem("key", 1); err != nil {
+		t.Error("Got:", err, "Expected:", nil)
+	}
+
+	inventory, _ := g.Inventory()
+	if len(inventory) != 1 || inventory[0].Name != "lamp" {
+		t.Error("Got:", inventory, "Expected:", "lamp")
+	}
+	if key, _ := g.Item("key"); key.Location != 1 {
+		t.Error("Got:", key.Location, "Expected:", 1)
+	}
+}
+
+func TestGameErrors(t *testing.T) {
+	g := testGame()
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"teleport into an item", g.Teleport(11), "room 11"},
+		{"teleport past memory", g.Teleport(30000), "no room at 30000"},
+		{"take something missing", g.Take("grue"), `no item called "grue"`},
+		{"move to nowhere", g.MoveItem("lamp", 30001), "no room at 30001"},
+	}
+
+	for _, test := range tests {
+		if test.err == nil || !strings.Contains(test.err.Error(), test.want) {
+			t.Error("Got:", test.err, "Expected:", test.want, "For:", test.name)
+		}
+	}
+
+	if room, _ := g.CurrentRoom(); room.Name != "Hall" {
+		t.Error("Got:", room.Name, "Expected:", "Hall")
+	}
+}
+
+func TestLoadLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "synacor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		json string
+		err  bool
+	}{
+		{`{"current_room": 0, "room": {"name": 0, "description": 1, "exit_names": 2, "exit_rooms": 3},
+		   "items": {"start": 11, "count": 2, "size": 4, "name": 0, "description": 1, "location": 2}}`, false},
+		{`{"current_rom": 0}`, true},
+		{`{`, true},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join(dir, "layout.json")
+		if err := ioutil.WriteFile(file, []byte(test.json), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		l, err := LoadLayout(file)
+		if (err != nil) != test.err {
+			t.Error("Got:", err, "Expected an error:", test.err)
+		}
+		if !test.err && !reflect.DeepEqual(l, testLayout) {
+			t.Error("Got:", l, "Expected:", testLayout)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package synacor
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Variant is a change to make to a clone of a Machine before running it.
+type Variant struct {
+	// Registers to set, by register number (0 through 7)
+	Registers map[int]uint16
+	// Memory to write, by address
+	Memory map[uint16]uint16
+	// Input fed to the in operation; running out of it stops the Machine
+	Input string
+}
+
+// Result is how running a Variant went.
+type Result struct {
+	// Index of the Variant in the list given to Harness.Run
+	Index   int
+	Variant Variant
+	Output  string
+	Stop    StopReason
+	Steps   uint64
+	// Fault is why the variant faulted, if it did
+	Fault *Fault
+	// Machine is the clone the variant ran on, to inspect afterwards
+	Machine Machine
+}
+
+// Harness runs many variants of a loaded Machine in parallel.
+type Harness struct {
+	// Workers is how many variants run at once; runtime.NumCPU() if 0
+	Workers int
+	// MaxSteps limits how many instructions each variant runs; 0 is no limit
+	MaxSteps uint64
+	// Keep decides which results are returned; all of them if nil
+	Keep func(Result) bool
+	// Cached runs variants with RunCached instead of RunSteps
+	Cached bool
+}
+
+// Run clones m for every variant, applies the variant to the clone and runs it
+// until it stops or hits MaxSteps.  Results are returned in variant order.
+func (h Harness) Run(m Machine, variants []Variant) []Result {
+	workers := h.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type job struct {
+		index   int
+		machine Machine
+	}
+
+	jobs := make(chan job)
+	results := make([]*Result, len(variants))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := h.run(j.machine, variants[j.index])
+				r.Index = j.index
+				if h.Keep == nil || h.Keep(r) {
+					results[j.index] = &r
+				}
+			}
+		}()
+	}
+
+	// clone here rather than in the workers; cloning marks m's memory shared
+	for i := range variants {
+		jobs <- job{i, m.Clone()}
+	}
+	close(jobs)
+	wg.Wait()
+
+	kept := []Result{}
+	for _, r := range results {
+		if r != nil {
+			kept = append(kept, *r)
+		}
+	}
+	return kept
+}
+
+func (h Harness) run(m Machine, v Variant) Result {
+	for n, value := range v.Registers {
+		m.SetRegister(n, value)
+	}
+	for address, value := range v.Memory {
+		m.SetMemory(address, value)
+	}
+
+	var out bytes.Buffer
+	m.SetOutput(&out)
+	m.SetInput(strings.NewReader(v.Input))
+
+	var stop StopReason
+	if h.Cached {
+		stop = m.RunCached(h.MaxSteps)
+	} else {
+		stop = m.RunSteps(h.MaxSteps)
+	}
+
+	return Result{Variant: v, Output: out.String(), Stop: stop, Fault: m.Fault(), Steps: m.Steps(), Machine: m}
+}
+
+// RegisterRange returns a Variant for every value from..to (inclusive) of
+// register n, each with the same input.
+func RegisterRange(n int, from, to uint16, input string) []Variant {
+	variants := []Variant{}
+	for v := int(from); v <= int(to); v++ {
+		variants = append(variants, Variant{
+			Registers: map[int]uint16{n: uint16(v)},
+			Input:     input,
+		})
+	}
+	return variants
+}
+
+// OutputContains returns a Keep function for a Harness that only keeps results
+// whose output contains s.
+func OutputContains(s string) func(Result) bool {
+	return func(r Result) bool {
+		return strings.Contains(r.Output, s)
+	}
+}
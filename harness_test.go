@@ -0,0 +1,152 @@
+package synacor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Outputs 'Y' when r7 is 5, otherwise 'N', then halts.
+var r7IsFive = []uint16{
+	uint16(opEq), register0, register7, 5,
+	uint16(opJt), register0, 10,
+	uint16(opOut), 'N',
+	uint16(opHalt),
+	uint16(opOut), 'Y',
+	uint16(opHalt),
+}
+
+func newTestMachine(memory []uint16) Machine {
+	m := NewMachine()
+	m.SetTrace(nil)
+	m.Program.memory = append([]uint16(nil), memory...)
+	return m
+}
+
+func TestMachineClone(t *testing.T) {
+	m := newTestMachine([]uint16{uint16(opWmem), 0, 42, uint16(opHalt)})
+	m.SetRegister(3, 7)
+	m.Stack.push(9)
+
+	c := m.Clone()
+	c.SetRegister(3, 8)
+	c.Stack.push(10)
+	c.RunSteps(0)
+
+	if m.Memory(0) != uint16(opWmem) {
+		t.Error("Got:", m.Memory(0), "Expected:", opWmem)
+	}
+	if c.Memory(0) != 42 {
+		t.Error("Got:", c.Memory(0), "Expected:", 42)
+	}
+	if m.Register(3) != 7 {
+		t.Error("Got:", m.Register(3), "Expected:", 7)
+	}
+	if len(*m.Stack) != 1 {
+		t.Error("Got:", len(*m.Stack), "Expected:", 1)
+	}
+	if c.Stopped() != Halted || m.Stopped() != NotStopped {
+		t.Error("Got:", c.Stopped(), m.Stopped(), "Expected:", Halted, NotStopped)
+	}
+
+	// the original copies memory on its own first write too
+	m.SetMemory(1, 5)
+	if c.Memory(1) != 0 {
+		t.Error("Got:", c.Memory(1), "Expected:", 0)
+	}
+}
+
+func TestMachineRunSteps(t *testing.T) {
+	tests := []struct {
+		memory   []uint16
+		input    string
+		limit    uint64
+		expected StopReason
+		output   string
+	}{
+		{[]uint16{uint16(opOut), 'a', uint16(opHalt)}, "", 0, Halted, "a"},
+		{[]uint16{uint16(opOut), 'a'}, "", 0, EndOfProgram, "a"},
+		{[]uint16{uint16(opJmp), 0}, "", 100, StepLimit, ""},
+		{[]uint16{uint16(opIn), register0, uint16(opOut), register0, uint16(opJmp), 0}, "hi\n", 0, InputExhausted, "hi\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		m := newTestMachine(test.memory)
+		m.SetOutput(&out)
+		m.SetInput(strings.NewReader(test.input))
+
+		result := m.RunSteps(test.limit)
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected)
+		}
+		if out.String() != test.output {
+			t.Error("Got:", out.String(), "Expected:", test.output)
+		}
+	}
+}
+
+func TestHarnessRun(t *testing.T) {
+	for _, cached := range []bool{false, true} {
+		m := newTestMachine(r7IsFive)
+
+		h := Harness{Workers: 3, MaxSteps: 1000, Keep: OutputContains("Y"), Cached: cached}
+		results := h.Run(m, RegisterRange(7, 1, 100, ""))
+
+		if len(results) != 1 {
+			t.Fatal("Got:", len(results), "Expected:", 1, "Cached:", cached)
+		}
+		if results[0].Index != 4 || results[0].Variant.Registers[7] != 5 {
+			t.Error("Got:", results[0].Index, results[0].Variant, "Expected:", 4, "r7 = 5", "Cached:", cached)
+		}
+		if results[0].Stop != Halted || results[0].Steps != 4 {
+			t.Error("Got:", results[0].Stop, results[0].Steps, "Expected:", Halted, 4, "Cached:", cached)
+		}
+	}
+}
+
+func TestHarnessRunVariants(t *testing.T) {
+	// echoes a line of input, then loops forever
+	m := newTestMachine([]uint16{
+		uint16(opIn), register0,
+		uint16(opOut), register0,
+		uint16(opEq), register1, register0, '\n',
+		uint16(opJf), register1, 0,
+		uint16(opRmem), register2, 20,
+		uint16(opOut), register2,
+		uint16(opJmp), 18,
+		uint16(opJmp), 18,
+		'.',
+	})
+
+	variants := []Variant{
+		{Input: "one\n"},
+		{Input: "two\n", Memory: map[uint16]uint16{20: '!'}},
+		{Input: "thr"},
+	}
+	results := Harness{MaxSteps: 100}.Run(m, variants)
+
+	expected := []struct {
+		output string
+		stop   StopReason
+	}{
+		{"one\n.", StepLimit},
+		{"two\n!", StepLimit},
+		{"thr", InputExhausted},
+	}
+
+	if len(results) != len(expected) {
+		t.Fatal("Got:", len(results), "Expected:", len(expected))
+	}
+	for i, r := range results {
+		if r.Output != expected[i].output || r.Stop != expected[i].stop {
+			t.Error("Got:", r.Output, r.Stop, "Expected:", expected[i].output, expected[i].stop)
+		}
+	}
+	if m.Memory(20) != '.' {
+		t.Error("Got:", m.Memory(20), "Expected:", '.')
+	}
+	if results[1].Machine.Memory(20) != '!' || results[1].Machine.Register(2) != '!' {
+		t.Error("Got:", results[1].Machine.Memory(20), results[1].Machine.Register(2), "Expected:", '!')
+	}
+}
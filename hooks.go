@@ -0,0 +1,79 @@
+package synacor
+
+import "fmt"
+
+// Hook is a native replacement for a function in the program.  It gets the
+// Machine as the call left it, with the return address on top of the stack,
+// and does to the registers, memory and the rest of the stack what the
+// function would.  The Machine then returns as if the function had run ret.
+// An error faults the Machine at the call, with the call undone: its return
+// address is popped and it's gone from the backtrace.
+type Hook func(m Machine) error
+
+// SetHook has calls to address run hook instead of the function there; nil
+// removes it.  A hooked call counts as one instruction.
+func (m Machine) SetHook(address uint16, hook Hook) {
+	p := m.Program
+	if hook == nil {
+		delete(p.hooks, address)
+		return
+	}
+	if p.hooks == nil {
+		p.hooks = make(map[uint16]Hook)
+	}
+	p.hooks[address] = hook
+}
+
+// hook runs the hook for the function just called, if there is one, and
+// returns from it.
+func (p *program) hook(r *registers, s *stack) {
+	hook, ok := p.hooks[uint16(p.index)]
+	if !ok {
+		return
+	}
+
+	p.tracef(", hooked")
+	if err := hook(Machine{p, s, r}); err != nil {
+		if !s.isEmpty() {
+			depth := len(*s)
+			p.returned(s.pop(), depth)
+		}
+		p.fault(fmt.Sprintf("hook for %v: %v", p.label(uint16(p.index)), err))
+		return
+	}
+	p.tracef(", ")
+	ret(p, r, s)
+}
+
+// ConfirmTeleporter is a Hook for the function the teleporter calls to check
+// the eighth register, confirm_teleporter.  It's a variant of the Ackermann
+// function, 15-bit, with r7 in place of 1:
+//
+//	f(0, n) = n + 1
+//	f(m, 0) = f(m - 1, r7)
+//	f(m, n) = f(m - 1, f(m, n - 1))
+//
+// which takes the program billions of instructions for f(r0, r1), but only a
+// row of 32768 values per m worked out in order.  Like the program it leaves
+// f(r0, r1) in r0 and one less in r1.
+func ConfirmTeleporter(m Machine) error {
+	a, b, c := m.Register(0), m.Register(1), m.Register(7)
+
+	// f(m, n) for every n, starting with m = 0
+	row := make([]uint16, modulo)
+	for n := range row {
+		row[n] = uint16((n + 1) % modulo)
+	}
+	for i := uint16(0); i < a; i++ {
+		next := make([]uint16, modulo)
+		next[0] = row[c]
+		for n := 1; n < modulo; n++ {
+			next[n] = row[next[n-1]]
+		}
+		row = next
+	}
+
+	m.SetRegister(0, row[b])
+	m.SetRegister(1, (row[b]+modulo-1)%modulo)
+	return nil
+}
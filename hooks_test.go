@@ -0,0 +1,134 @@
+package synacor
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// confirmTeleporter is the teleporter's confirmation function as the
+// challenge has it, after a call to it.
+const confirmTeleporter = `
+	call f; halt
+f:	jt r0 m
+	add r0 r1 1
+	ret
+m:	jt r1 mn
+	add r0 r0 32767
+	set r1 r7
+	call f
+	ret
+mn:	push r0
+	add r1 r1 32767
+	call f
+	set r1 r0
+	pop r0
+	add r0 r0 32767
+	call f
+	ret`
+
+func TestConfirmTeleporter(t *testing.T) {
+	tests := []struct {
+		r0, r1, r7 uint16
+	}{
+		{0, 7, 4},
+		{1, 5, 3},
+		{2, 1, 1},
+		{2, 3, 2},
+		{3, 1, 1},
+		{3, 2, 1},
+	}
+
+	for _, test := range tests {
+		machines := []Machine{assembled(t, confirmTeleporter), assembled(t, confirmTeleporter)}
+		machines[1].SetHook(3, ConfirmTeleporter)
+
+		for _, m := range machines {
+			m.SetStack([]uint16{99})
+			m.SetRegister(0, test.r0)
+			m.SetRegister(1, test.r1)
+			m.SetRegister(7, test.r7)
+			if stop := m.RunSteps(50000000); stop != Halted {
+				t.Fatal("Got:", stop, "Expected:", Halted, "For:", test)
+			}
+		}
+
+		program, hooked := machines[0], machines[1]
+		if *program.Registers != *hooked.Registers || !reflect.DeepEqual(*program.Stack, *hooked.Stack) {
+			t.Error("Got:", hooked.Registers, hooked.Stack, "Expected:", program.Registers, program.Stack, "For:", test)
+		}
+		if hooked.Steps() != 2 || len(hooked.Backtrace()) != 0 {
+			t.Error("Got:", hooked.Steps(), hooked.Backtrace(), "Expected: a call and a halt", "For:", test)
+		}
+	}
+}
+
+func TestConfirmTeleporterEighthRegister(t *testing.T) {
+	// the value the teleporter wants
+	m := assembled(t, "call 3; halt; halt")
+	m.SetHook(3, ConfirmTeleporter)
+	m.SetRegister(0, 4)
+	m.SetRegister(1, 1)
+	m.SetRegister(7, 25734)
+	m.RunSteps(0)
+
+	if m.Register(0) != 6 || m.PC() != 2 {
+		t.Error("Got:", m.Register(0), m.PC(), "Expected:", 6, 2)
+	}
+}
+
+func TestMachineSetHook(t *testing.T) {
+	m := assembled(t, "call f; out r0; halt; f: set r0 'a'; ret")
+	var trace, output bytes.Buffer
+	m.SetTrace(&trace)
+	m.SetOutput(&output)
+
+	// hooks can use the stack, and return like ret
+	m.SetHook(5, func(m Machine) error {
+		m.SetStack(append(*m.Stack, 'b'))
+		m.SetRegister(0, m.Stack.pop())
+		return nil
+	})
+	c := m.Clone()
+	c.SetOutput(&output)
+
+	m.RunSteps(0)
+	if output.String() != "b" || m.Steps() != 3 {
+		t.Error("Got:", output.String(), m.Steps(), "Expected:", "b", 3)
+	}
+	if !strings.Contains(trace.String(), "hooked") {
+		t.Error("Got:", trace.String(), "Expected: the hooked call traced")
+	}
+
+	// clones keep their hooks, and removing one doesn't touch the original's
+	c.SetHook(5, nil)
+	c.RunSteps(0)
+	if output.String() != "ba" {
+		t.Error("Got:", output.String(), "Expected:", "ba")
+	}
+	if _, ok := m.Program.hooks[5]; !ok {
+		t.Error("Got:", m.Program.hooks, "Expected: the original's hook")
+	}
+}
+
+func TestMachineHookError(t *testing.T) {
+	m := assembled(t, "call 3; halt; ret")
+	m.SetHook(3, func(m Machine) error { return errors.New("no") })
+
+	if stop := m.RunSteps(0); stop != Faulted {
+		t.Fatal("Got:", stop, "Expected:", Faulted)
+	}
+	if f := m.Fault(); f.Address != 0 || f.Reason != "hook for 3: no" {
+		t.Error("Got:", f, "Expected: a fault at the call")
+	}
+
+	// the call's undone, so it isn't left on the stack or the backtrace
+	if len(*m.Stack) != 0 {
+		t.Error("Got:", *m.Stack, "Expected:", stack{})
+	}
+	if b := m.Backtrace(); len(b) != 0 {
+		t.Error("Got:", b, "Expected: no frames")
+	}
+}
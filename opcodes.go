@@ -2,7 +2,6 @@ package synacor
 
 import (
 	"fmt"
-	"os"
 )
 
 type opcode uint8
@@ -89,14 +88,41 @@ var operatorPropertyMap = map[opcode]operatorProperty{
 	opWmem: {"wmem", 2},
 }
 
+// arithmetic is the one place 15-bit arithmetic is done: the operands are
+// widened to 32 bits so nothing can overflow before the result is taken modulo
+// 32768.
+func arithmetic(op opcode, b, c uint16) uint16 {
+	x, y := uint32(b), uint32(c)
+
+	var v uint32
+	switch op {
+	case opAdd:
+		v = x + y
+	case opMult:
+		v = x * y
+	case opMod:
+		v = x % y
+	case opAnd:
+		v = x & y
+	case opOr:
+		v = x | y
+	case opNot:
+		v = ^x
+	default:
+		panic(fmt.Sprintf("%d is not an arithmetic operation", op))
+	}
+	return uint16(v % modulo)
+}
+
 // add: 9 a b c
 //  assign into <a> the sum of <b> and <c> (modulo 32768)
 func add(p *program, r *registers, s *stack) {
 	a := p.getNextRaw()
 	b := p.getNext(r)
 	c := p.getNext(r)
-	r.set(a, (b+c)%modulo)
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, %d, Setting: %d", a, b, c, (b+c)%modulo)
+	v := arithmetic(opAdd, b, c)
+	p.store(r, a, v)
+	p.tracef("op args: %d, %d, %d, Setting: %d", a, b, c, v)
 	p.index = p.index + 1
 }
 
@@ -106,8 +132,9 @@ func and(p *program, r *registers, s *stack) {
 	a := p.getNextRaw()
 	b := p.getNext(r)
 	c := p.getNext(r)
-	r.set(a, b&c)
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, %d, Setting: %d", a, b, c, b&c)
+	v := arithmetic(opAnd, b, c)
+	p.store(r, a, v)
+	p.tracef("op args: %d, %d, %d, Setting: %d", a, b, c, v)
 	p.index = p.index + 1
 }
 
@@ -115,9 +142,14 @@ func and(p *program, r *registers, s *stack) {
 //   write the address of the next instruction to the stack and jump to <a>
 func call(p *program, r *registers, s *stack) {
 	a := p.getNext(r)
+	if p.stackFull(s) {
+		return
+	}
 	s.push(uint16(p.index) + 1)
-	fmt.Fprintf(os.Stderr, "op args: %d, Stack Push: %d", a, p.index+1)
+	p.called(a, s)
+	p.tracef("op args: %v, Stack Push: %v, Calls: %v", p.label(a), p.label(uint16(p.index+1)), callChain{p})
 	p.index = int(a)
+	p.hook(r, s)
 }
 
 // eq: 4 a b c
@@ -131,9 +163,9 @@ func eq(p *program, r *registers, s *stack) {
 	if b == c {
 		set = 1
 	}
-	r.set(a, uint16(set))
+	p.store(r, a, uint16(set))
 
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, %d, Setting: %d", a, b, c, set)
+	p.tracef("op args: %d, %d, %d, Setting: %d", a, b, c, set)
 	p.index = p.index + 1
 }
 
@@ -148,17 +180,17 @@ func gt(p *program, r *registers, s *stack) {
 	if b > c {
 		set = 1
 	}
-	r.set(a, uint16(set))
+	p.store(r, a, uint16(set))
 
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, %d, Setting: %d", a, b, c, set)
+	p.tracef("op args: %d, %d, %d, Setting: %d", a, b, c, set)
 	p.index = p.index + 1
 }
 
 // halt: 0
 //   stop execution and terminate the program
 func halt(p *program, r *registers, s *stack) {
-	fmt.Fprintf(os.Stderr, "op args: n/a")
-	os.Exit(0)
+	p.tracef("op args: n/a")
+	p.stop = Halted
 }
 
 // in: 20 a
@@ -170,8 +202,9 @@ func halt(p *program, r *registers, s *stack) {
 func in(p *program, r *registers, s *stack) {
 	if len(p.input) == 0 {
 		if err := p.getChars(); err != nil {
-			fmt.Fprintln(os.Stderr, "Error from p.getChars():", err)
-			halt(p, r, s)
+			p.tracef("Error from p.getChars(): %v", err)
+			p.stop = InputExhausted
+			return
 		}
 	}
 
@@ -179,9 +212,9 @@ func in(p *program, r *registers, s *stack) {
 
 	b := p.input[0]
 	p.input = p.input[1:]
-	r.set(a, b)
+	p.store(r, a, b)
 
-	fmt.Fprintf(os.Stderr, "op args: %d, Setting: %d (Char: %s)", a, b, string(rune(b)))
+	p.tracef("op args: %d, Setting: %d (Char: %s)", a, b, string(rune(b)))
 	p.index = p.index + 1
 }
 
@@ -189,7 +222,7 @@ func in(p *program, r *registers, s *stack) {
 //   jump to <a>
 func jump(p *program, r *registers, s *stack) {
 	p.index = int(p.getNext(r))
-	fmt.Fprintf(os.Stderr, "op args: %d, jump location: %d", p.index, p.index)
+	p.tracef("op args: %d, jump location: %v", p.index, p.label(uint16(p.index)))
 }
 
 // jf: 8 a b
@@ -203,7 +236,7 @@ func jumpFalse(p *program, r *registers, s *stack) {
 	} else {
 		p.index = p.index + 1
 	}
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, jump location: %d", a, b, p.index)
+	p.tracef("op args: %d, %v, jump location: %v", a, p.label(b), p.label(uint16(p.index)))
 }
 
 // jt: 7 a b
@@ -217,7 +250,7 @@ func jumpTrue(p *program, r *registers, s *stack) {
 	} else {
 		p.index = p.index + 1
 	}
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, jump location: %d", a, b, p.index)
+	p.tracef("op args: %d, %v, jump location: %v", a, p.label(b), p.label(uint16(p.index)))
 }
 
 // mod: 11 a b c
@@ -226,8 +259,13 @@ func mod(p *program, r *registers, s *stack) {
 	a := p.getNextRaw()
 	b := p.getNext(r)
 	c := p.getNext(r)
-	r.set(a, b%c)
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, %d, Setting: %d", a, b, c, b%c)
+	if c == 0 {
+		p.fault("mod by zero")
+		return
+	}
+	v := arithmetic(opMod, b, c)
+	p.store(r, a, v)
+	p.tracef("op args: %d, %d, %d, Setting: %d", a, b, c, v)
 	p.index = p.index + 1
 }
 
@@ -237,8 +275,9 @@ func mult(p *program, r *registers, s *stack) {
 	a := p.getNextRaw()
 	b := p.getNext(r)
 	c := p.getNext(r)
-	r.set(a, (b*c)%modulo)
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, %d, Setting: %d", a, b, c, (b*c)%modulo)
+	v := arithmetic(opMult, b, c)
+	p.store(r, a, v)
+	p.tracef("op args: %d, %d, %d, Setting: %d", a, b, c, v)
 	p.index = p.index + 1
 }
 
@@ -246,7 +285,7 @@ func mult(p *program, r *registers, s *stack) {
 //   no operation
 func noop(p *program, r *registers, s *stack) {
 	p.index = p.index + 1
-	fmt.Fprintf(os.Stderr, "op args: n/a")
+	p.tracef("op args: n/a")
 }
 
 // not: 14 a b
@@ -254,8 +293,9 @@ func noop(p *program, r *registers, s *stack) {
 func not(p *program, r *registers, s *stack) {
 	a := p.getNextRaw()
 	b := p.getNext(r)
-	r.set(a, ^b%modulo)
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, Setting: %d", a, b, ^b%modulo)
+	v := arithmetic(opNot, b, 0)
+	p.store(r, a, v)
+	p.tracef("op args: %d, %d, Setting: %d", a, b, v)
 	p.index = p.index + 1
 }
 
@@ -265,17 +305,22 @@ func or(p *program, r *registers, s *stack) {
 	a := p.getNextRaw()
 	b := p.getNext(r)
 	c := p.getNext(r)
-	r.set(a, b|c)
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, %d, Setting: %d", a, b, c, b|c)
+	v := arithmetic(opOr, b, c)
+	p.store(r, a, v)
+	p.tracef("op args: %d, %d, %d, Setting: %d", a, b, c, v)
 	p.index = p.index + 1
 }
 
 // out: 19 a
 //   write the character represented by ascii code <a> to the terminal
 func out(p *program, r *registers, s *stack) {
-	a := string(rune(p.getNext(r)))
-	fmt.Print(a)
-	fmt.Fprintf(os.Stderr, "op args: %s", a)
+	c := rune(p.getNext(r))
+	a := string(c)
+	fmt.Fprint(p.out(), a)
+	if p.codes != nil {
+		p.codes.observe(c, p.steps)
+	}
+	p.tracef("op args: %s", a)
 	p.index = p.index + 1
 }
 
@@ -283,8 +328,11 @@ func out(p *program, r *registers, s *stack) {
 //   push <a> onto the stack
 func push(p *program, r *registers, s *stack) {
 	a := p.getNext(r)
+	if p.stackFull(s) {
+		return
+	}
 	s.push(a)
-	fmt.Fprintf(os.Stderr, "op args: %d", a)
+	p.tracef("op args: %d", a)
 	p.index = p.index + 1
 }
 
@@ -292,9 +340,13 @@ func push(p *program, r *registers, s *stack) {
 //   remove the top element from the stack and write it into <a>; empty stack = error
 func pop(p *program, r *registers, s *stack) {
 	a := p.getNextRaw()
+	if s.isEmpty() {
+		p.fault("pop on an empty stack")
+		return
+	}
 	b := s.pop()
-	r.set(a, b)
-	fmt.Fprintf(os.Stderr, "op args: %d, stack arg: %d", a, b)
+	p.store(r, a, b)
+	p.tracef("op args: %d, stack arg: %d", a, b)
 	p.index = p.index + 1
 }
 
@@ -303,10 +355,14 @@ func pop(p *program, r *registers, s *stack) {
 func ret(p *program, r *registers, s *stack) {
 	if s.isEmpty() {
 		halt(p, r, s)
+		return
 	}
 
+	depth := len(*s)
 	a := s.pop()
-	fmt.Fprintf(os.Stderr, "op args: n/a, stack arg: %d", a)
+	p.tracef("op args: n/a, stack arg: %v", p.label(a))
+	p.returned(a, depth)
+	p.tracef(", Calls: %v", callChain{p})
 	p.index = int(a)
 }
 
@@ -315,10 +371,10 @@ func ret(p *program, r *registers, s *stack) {
 func rmem(p *program, r *registers, s *stack) {
 	a := p.getNextRaw()
 	b := p.getNext(r)
-	m := p.memory[b]
+	m := p.read(b)
 
-	r.set(a, m)
-	fmt.Fprintf(os.Stderr, "op args: %d, %d, memory value: %d", a, b, m)
+	p.store(r, a, m)
+	p.tracef("op args: %d, %v, memory value: %d", a, p.label(b), m)
 	p.index = p.index + 1
 }
 
@@ -328,10 +384,8 @@ func set(p *program, r *registers, s *stack) {
 	a := p.getNextRaw()
 	b := p.getNext(r)
 
-	if isRegister(a) {
-		r.set(a, b)
-	}
-	fmt.Fprintf(os.Stderr, "op args: %d, %d", a, b)
+	p.store(r, a, b)
+	p.tracef("op args: %d, %d", a, b)
 	p.index = p.index + 1
 }
 
@@ -340,8 +394,8 @@ func set(p *program, r *registers, s *stack) {
 func wmem(p *program, r *registers, s *stack) {
 	a := p.getNext(r)
 	b := p.getNext(r)
-	p.memory[a] = b
+	p.write(a, b)
 
-	fmt.Fprintf(os.Stderr, "op args: %d, %d", a, b)
+	p.tracef("op args: %v, %d", p.label(a), b)
 	p.index = p.index + 1
 }
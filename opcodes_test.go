@@ -2,8 +2,12 @@ package synacor
 
 import (
 	"encoding/binary"
+	"math/big"
+	"math/rand"
 	"os"
+	"reflect"
 	"testing"
+	"testing/quick"
 )
 
 func TestAdd(t *testing.T) {
@@ -447,8 +451,8 @@ func TestRmem(t *testing.T) {
 		s        stack
 		expected int
 	}{
-		{program{index: 0, memory: []uint16{0, 2, 2, 3}}, r, stack{27}, 0},
-		{program{index: 0, memory: []uint16{0, 2, 2, 4}}, r, stack{14}, 0},
+		{program{index: 0, memory: []uint16{0, 32770, 2, 3}}, r, stack{27}, 0},
+		{program{index: 0, memory: []uint16{0, 32770, 2, 4}}, r, stack{14}, 0},
 	}
 
 	for _, test := range tests {
@@ -518,3 +522,83 @@ func TestWmem(t *testing.T) {
 		}
 	}
 }
+
+// operand is a random 15-bit value for property tests, picked from the edges of
+// the range a quarter of the time.
+type operand uint16
+
+var operandEdges = []uint16{0, 1, 2, 16383, 16384, 32766, 32767}
+
+func (operand) Generate(r *rand.Rand, size int) reflect.Value {
+	if r.Intn(4) == 0 {
+		return reflect.ValueOf(operand(operandEdges[r.Intn(len(operandEdges))]))
+	}
+	return reflect.ValueOf(operand(r.Intn(modulo)))
+}
+
+// referenceArithmetic is what the arch-spec says each operation results in,
+// worked out with arbitrary precision.
+func referenceArithmetic(op opcode, b, c uint16) uint16 {
+	x, y, m := big.NewInt(int64(b)), big.NewInt(int64(c)), big.NewInt(modulo)
+	v := new(big.Int)
+
+	switch op {
+	case opAdd:
+		v.Add(x, y)
+	case opMult:
+		v.Mul(x, y)
+	case opMod:
+		v.Mod(x, y)
+	case opAnd:
+		v.And(x, y)
+	case opOr:
+		v.Or(x, y)
+	case opNot:
+		v.Sub(big.NewInt(maxAllowedLiteral), x)
+	}
+	return uint16(v.Mod(v, m).Uint64())
+}
+
+func TestArithmeticProperties(t *testing.T) {
+	ops := []struct {
+		code opcode
+		fn   operator
+	}{
+		{opAdd, add},
+		{opMult, mult},
+		{opMod, mod},
+		{opAnd, and},
+		{opOr, or},
+		{opNot, not},
+	}
+
+	for _, op := range ops {
+		op := op
+		args := operatorPropertyMap[op.code].args
+
+		// the operation, run on literal operands and on operands in registers,
+		// has to match the reference
+		property := func(b, c operand) bool {
+			if op.code == opMod && c == 0 {
+				c = 1
+			}
+			expected := referenceArithmetic(op.code, uint16(b), uint16(c))
+
+			literal := program{memory: []uint16{uint16(op.code), register0, uint16(b), uint16(c)}[:args+1]}
+			r := registers{}
+			op.fn(&literal, &r, &stack{})
+			if r[0] != expected || arithmetic(op.code, uint16(b), uint16(c)) != expected {
+				return false
+			}
+
+			inRegisters := program{memory: []uint16{uint16(op.code), register0, register1, register2}[:args+1]}
+			r = registers{0, uint16(b), uint16(c)}
+			op.fn(&inRegisters, &r, &stack{})
+			return r[0] == expected
+		}
+
+		if err := quick.Check(property, &quick.Config{MaxCount: 5000}); err != nil {
+			t.Error(operatorPropertyMap[op.code].name, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package synacor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Patch replaces the words of memory from Start up to End with Code, padded
+// with noop.
+type Patch struct {
+	Start, End int
+	Code       []uint16
+	// Line of the patch file the patch came from
+	Line int
+}
+
+// ParsePatches reads a patch file.  Each line is
+//
+//	<where>: <instructions>
+//
+// where <where> is an address or symbol name, replacing the one instruction
+// there, or <first>-<last> replacing every instruction from first to last.
+// Instructions are assembly separated by ';' and have to fit in what they
+// replace; what's left over is filled with noop.  '#' starts a comment.
+func ParsePatches(src string, memory []uint16, symbols *Symbols) ([]Patch, error) {
+	patches := []Patch{}
+
+	for n, line := range strings.Split(src, "\n") {
+		text := strings.TrimSpace(line)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		i := strings.Index(text, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected '<where>: <instructions>'", n+1)
+		}
+
+		p, err := patchFootprint(strings.TrimSpace(text[:i]), memory, symbols)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		p.Line = n + 1
+
+		p.Code, err = Assemble(text[i+1:], uint16(p.Start), symbols)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if len(p.Code) > p.End-p.Start {
+			return nil, fmt.Errorf("line %d: %d words don't fit in the %d words at %s",
+				n+1, len(p.Code), p.End-p.Start, symbols.Name(uint16(p.Start)))
+		}
+		patches = append(patches, p)
+	}
+	return patches, nil
+}
+
+// patchFootprint works out the words a patch replaces from where it's applied.
+func patchFootprint(where string, memory []uint16, symbols *Symbols) (Patch, error) {
+	from, to := where, ""
+	if i := strings.Index(where, "-"); i > 0 {
+		from, to = strings.TrimSpace(where[:i]), strings.TrimSpace(where[i+1:])
+	}
+
+	start, err := patchAddress(from, memory, symbols)
+	if err != nil {
+		return Patch{}, err
+	}
+
+	if to == "" {
+		return Patch{Start: start, End: start + Decode(memory, uint16(start)).Size()}, nil
+	}
+
+	end, err := patchAddress(to, memory, symbols)
+	if err != nil {
+		return Patch{}, err
+	}
+	if end < start {
+		return Patch{}, fmt.Errorf("%s ends before it starts", where)
+	}
+
+	// the last address has to be the end of an instruction, not the middle
+	a, last := start, start
+	for a <= end {
+		last = a
+		a += Decode(memory, uint16(a)).Size()
+	}
+	if a != end+1 {
+		return Patch{}, fmt.Errorf("%s ends in the middle of the instruction at %d", where, last)
+	}
+	return Patch{Start: start, End: end + 1}, nil
+}
+
+func patchAddress(s string, memory []uint16, symbols *Symbols) (int, error) {
+	a, err := resolve(s, nil, symbols)
+	if err != nil {
+		return 0, err
+	}
+	if int(a) >= len(memory) {
+		return 0, fmt.Errorf("%s is past the end of the program", s)
+	}
+	return int(a), nil
+}
+
+// ApplyPatches returns a copy of memory with the patches applied.
+func ApplyPatches(memory []uint16, patches []Patch) ([]uint16, error) {
+	sorted := append([]Patch(nil), patches...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	patched := append([]uint16(nil), memory...)
+	for i, p := range sorted {
+		if p.Start < 0 || p.End > len(memory) || len(p.Code) > p.End-p.Start {
+			return nil, fmt.Errorf("patch from line %d doesn't fit at %d", p.Line, p.Start)
+		}
+		if i > 0 && sorted[i-1].End > p.Start {
+			return nil, fmt.Errorf("patches from lines %d and %d overlap", sorted[i-1].Line, p.Line)
+		}
+
+		copy(patched[p.Start:], p.Code)
+		for a := p.Start + len(p.Code); a < p.End; a++ {
+			patched[a] = uint16(opNoop)
+		}
+	}
+	return patched, nil
+}
@@ -0,0 +1,103 @@
+package synacor
+
+import (
+	"strings"
+	"testing"
+)
+
+// call 7; eq r1 r0 6; halt; noop; jt r0 1; ret
+var patchTestMemory = []uint16{
+	uint16(opCall), 7,
+	uint16(opEq), register1, register0, 6,
+	uint16(opHalt),
+	uint16(opJt), register0, 1,
+	uint16(opRet),
+}
+
+func TestParsePatches(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 7, Type: Function, Name: "check"})
+
+	src := `# skip the check
+0: noop; noop
+check-check+3: set r0 6; ret
+`
+	patches, err := ParsePatches(src, patchTestMemory, s)
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	patched, err := ApplyPatches(patchTestMemory, patches)
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	expected := []uint16{
+		uint16(opNoop), uint16(opNoop),
+		uint16(opEq), register1, register0, 6,
+		uint16(opHalt),
+		uint16(opSet), register0, 6,
+		uint16(opRet),
+	}
+	for i := range expected {
+		if patched[i] != expected[i] {
+			t.Error("Got:", patched[i], "Expected:", expected[i], "At:", i)
+		}
+	}
+
+	if patchTestMemory[0] != uint16(opCall) {
+		t.Error("Got:", patchTestMemory[0], "Expected:", opCall)
+	}
+}
+
+func TestParsePatchesPadding(t *testing.T) {
+	patches, err := ParsePatches("2: set r1 1", patchTestMemory, nil)
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	patched, err := ApplyPatches(patchTestMemory, patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []uint16{uint16(opSet), register1, 1, uint16(opNoop), uint16(opHalt)}
+	for i, e := range expected {
+		if patched[2+i] != e {
+			t.Error("Got:", patched[2+i], "Expected:", e, "At:", 2+i)
+		}
+	}
+}
+
+func TestParsePatchesErrors(t *testing.T) {
+	tests := []struct {
+		src   string
+		error string
+	}{
+		{"0 noop", "expected '<where>: <instructions>'"},
+		{"0: set r0 6", "don't fit"},
+		{"0-3: noop", "middle of the instruction at 2"},
+		{"5-2: noop", "ends before it starts"},
+		{"500: noop", "past the end"},
+		{"nowhere: noop", "unknown name"},
+		{"0: bogus", "unknown operation"},
+	}
+
+	for _, test := range tests {
+		_, err := ParsePatches(test.src, patchTestMemory, nil)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Error("Got:", err, "Expected:", test.error)
+		}
+	}
+}
+
+func TestApplyPatchesOverlap(t *testing.T) {
+	patches := []Patch{
+		{Start: 2, End: 6, Line: 1},
+		{Start: 0, End: 3, Line: 2},
+	}
+
+	if _, err := ApplyPatches(patchTestMemory, patches); err == nil {
+		t.Error("Expected an error for overlapping patches")
+	}
+}
@@ -0,0 +1,162 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+// Client talks to a Server.  It sends one request at a time, so it isn't safe
+// to use from more than one goroutine; pausing a continue needs a second
+// Client.
+type Client struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	enc     *json.Encoder
+	id      int
+	// game output received but not read yet
+	output strings.Builder
+}
+
+// Dial connects to a Server listening on address, in the form Listen takes.
+func Dial(address string) (*Client, error) {
+	conn, err := net.Dial(network(address))
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a Client that talks to a Server over conn.
+func NewClient(conn net.Conn) *Client {
+	scanner := bufio.NewScanner(conn)
+	// a snapshot holds the whole image
+	scanner.Buffer(nil, 1<<20)
+	return &Client{conn: conn, scanner: scanner, enc: json.NewEncoder(conn)}
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends a request and returns the response.  An error from the server is
+// returned as an error, along with the response.
+func (c *Client) Do(req Request) (Response, error) {
+	c.id++
+	req.ID = c.id
+
+	var resp Response
+	if err := c.enc.Encode(req); err != nil {
+		return resp, err
+	}
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return resp, err
+		}
+		return resp, errors.New("the server closed the connection")
+	}
+	if err := json.Unmarshal(c.scanner.Bytes(), &resp); err != nil {
+		return resp, err
+	}
+
+	c.output.WriteString(resp.Output)
+	if resp.ID != req.ID {
+		return resp, fmt.Errorf("got the response to request %d, expected %d", resp.ID, req.ID)
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// Output returns what the game has printed since Output was last called.
+func (c *Client) Output() string {
+	s := c.output.String()
+	c.output.Reset()
+	return s
+}
+
+// state sends a request and returns the state of the Machine after it.
+func (c *Client) state(req Request) (State, error) {
+	resp, err := c.Do(req)
+	return resp.State, err
+}
+
+// State returns the state of the Machine.
+func (c *Client) State() (State, error) {
+	return c.state(Request{Command: CommandState})
+}
+
+// Step executes n instructions.
+func (c *Client) Step(n uint64) (State, error) {
+	return c.state(Request{Command: CommandStep, Count: n})
+}
+
+// Continue runs until a breakpoint, the Machine needs input or stops, it's
+// paused or it's executed limit instructions (0 is no limit).
+func (c *Client) Continue(limit uint64) (State, error) {
+	return c.state(Request{Command: CommandContinue, Count: limit})
+}
+
+// Pause stops a continue another Client is waiting on.
+func (c *Client) Pause() (State, error) {
+	return c.state(Request{Command: CommandPause})
+}
+
+// Break sets a breakpoint at an address.
+func (c *Client) Break(address uint16) error {
+	_, err := c.Do(Request{Command: CommandBreak, Address: address})
+	return err
+}
+
+// Clear removes the breakpoint at an address.
+func (c *Client) Clear(address uint16) error {
+	_, err := c.Do(Request{Command: CommandClear, Address: address})
+	return err
+}
+
+// ReadMemory returns n words of memory from an address.
+func (c *Client) ReadMemory(address uint16, n int) ([]uint16, error) {
+	resp, err := c.Do(Request{Command: CommandReadMemory, Address: address, Count: uint64(n)})
+	return resp.Values, err
+}
+
+// WriteMemory writes values to memory from an address.
+func (c *Client) WriteMemory(address uint16, values []uint16) error {
+	_, err := c.Do(Request{Command: CommandWriteMemory, Address: address, Values: values})
+	return err
+}
+
+// WriteRegister sets register n (0 through 7) to a value.
+func (c *Client) WriteRegister(n int, value uint16) error {
+	_, err := c.Do(Request{Command: CommandWriteRegister, Register: n, Value: value})
+	return err
+}
+
+// WriteStack replaces the stack with values, the top of the stack last.
+func (c *Client) WriteStack(values []uint16) error {
+	_, err := c.Do(Request{Command: CommandWriteStack, Values: values})
+	return err
+}
+
+// Input queues input for the game, which reads it a line at a time.
+func (c *Client) Input(input string) error {
+	_, err := c.Do(Request{Command: CommandInput, Input: input})
+	return err
+}
+
+// Snapshot returns the Machine as a container.
+func (c *Client) Snapshot(title string) (synacor.Container, error) {
+	resp, err := c.Do(Request{Command: CommandSnapshot, Title: title})
+	if err != nil {
+		return synacor.Container{}, err
+	}
+	return synacor.ReadProgram(bytes.NewReader(resp.Data))
+}
@@ -0,0 +1,107 @@
+// Package remote serves a Machine for debugging over a TCP or unix socket and
+// has a client for it.
+//
+// The protocol is line-delimited JSON: the client writes a Request on a line
+// and the server answers with a Response on a line, in the same order.
+package remote
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pladdy/synacor"
+)
+
+// Commands a Request can give.
+const (
+	// CommandState returns the Machine's state
+	CommandState = "state"
+	// CommandStep executes Count instructions, 1 if Count is 0
+	CommandStep = "step"
+	// CommandContinue runs until a breakpoint, the Machine needs input or
+	// stops, it's paused or it's executed Count instructions (0 is no limit)
+	CommandContinue = "continue"
+	// CommandPause stops a continue, from another connection
+	CommandPause = "pause"
+	// CommandBreak sets a breakpoint at Address
+	CommandBreak = "break"
+	// CommandClear removes the breakpoint at Address
+	CommandClear = "clear"
+	// CommandReadMemory returns Count words of memory from Address
+	CommandReadMemory = "read-memory"
+	// CommandWriteMemory writes Values to memory from Address
+	CommandWriteMemory = "write-memory"
+	// CommandWriteRegister sets Register to Value
+	CommandWriteRegister = "write-register"
+	// CommandWriteStack replaces the stack with Values, the top last
+	CommandWriteStack = "write-stack"
+	// CommandInput queues Input for the game, a line at a time
+	CommandInput = "input"
+	// CommandSnapshot returns the Machine as a container, titled Title
+	CommandSnapshot = "snapshot"
+)
+
+// Request is a command for the server.  Only the fields the command uses need
+// to be set.
+type Request struct {
+	// ID is returned in the Response
+	ID       int      `json:"id"`
+	Command  string   `json:"command"`
+	Address  uint16   `json:"address,omitempty"`
+	Count    uint64   `json:"count,omitempty"`
+	Register int      `json:"register,omitempty"`
+	Value    uint16   `json:"value,omitempty"`
+	Values   []uint16 `json:"values,omitempty"`
+	Input    string   `json:"input,omitempty"`
+	Title    string   `json:"title,omitempty"`
+}
+
+// Response is the server's answer to a Request.
+type Response struct {
+	ID    int    `json:"id"`
+	Error string `json:"error,omitempty"`
+	State State  `json:"state"`
+	// Output is what the game printed since the last Response
+	Output string `json:"output,omitempty"`
+	// Values is the memory read by read-memory
+	Values []uint16 `json:"values,omitempty"`
+	// Data is the container written by snapshot
+	Data []byte `json:"data,omitempty"`
+}
+
+// Reasons the Machine isn't running, besides the ones it stops for.
+const (
+	StatusPaused     = "paused"
+	StatusBreakpoint = "breakpoint"
+	StatusWaiting    = "waiting for input"
+)
+
+// State is the state of the Machine after a Request.
+type State struct {
+	// Status is why the Machine isn't running: paused, at a breakpoint,
+	// waiting for input or the reason it stopped, like halted
+	Status      string    `json:"status"`
+	PC          int       `json:"pc"`
+	Steps       uint64    `json:"steps"`
+	Registers   [8]uint16 `json:"registers"`
+	Stack       []uint16  `json:"stack"`
+	Breakpoints []uint16  `json:"breakpoints"`
+	// Backtrace is the calls the program is in, innermost first
+	Backtrace synacor.Backtrace `json:"backtrace"`
+	// Fault is why the Machine faulted, if it did
+	Fault string `json:"fault,omitempty"`
+}
+
+// Listen listens on address: a TCP address like localhost:4000 or unix:<path>
+// for a unix socket.
+func Listen(address string) (net.Listener, error) {
+	return net.Listen(network(address))
+}
+
+// network splits an address into its network and address.
+func network(address string) (string, string) {
+	if strings.HasPrefix(address, "unix:") {
+		return "unix", strings.TrimPrefix(address, "unix:")
+	}
+	return "tcp", address
+}
@@ -0,0 +1,267 @@
+package remote
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pladdy/synacor"
+)
+
+// echo prompts with '>' and echoes a line, twice, then halts.
+const echo = `
+	start: out '>'
+	read: in r0; out r0; eq r1 r0 '\n'; jf r1 read
+	add r2 r2 1; eq r3 r2 2; jf r3 start
+	halt`
+
+// Address of the add after a line's been echoed.
+const echoed = 13
+
+// testServer serves a machine running src on address and returns a client
+// connected to it.
+func testServer(t *testing.T, address, src string) *Client {
+	program, err := synacor.Assemble(src, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := synacor.NewMachine()
+	m.SetTrace(nil)
+	m.SetMemory(uint16(len(program)-1), 0)
+	for a, v := range program {
+		m.SetMemory(uint16(a), v)
+	}
+
+	l, err := Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewServer(m).Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	return testClient(t, l.Addr())
+}
+
+func testClient(t *testing.T, address net.Addr) *Client {
+	conn, err := net.Dial(address.Network(), address.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(conn)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClientStep(t *testing.T) {
+	c := testServer(t, "127.0.0.1:0", echo)
+
+	tests := []struct {
+		n      uint64
+		status string
+		pc     int
+		output string
+	}{
+		{0, StatusPaused, 2, ">"},
+		{5, StatusWaiting, 2, ""},
+	}
+
+	for _, test := range tests {
+		state, err := c.Step(test.n)
+		if err != nil {
+			t.Fatal("Got:", err, "Expected:", nil)
+		}
+		if state.Status != test.status || state.PC != test.pc || state.Steps != 1 {
+			t.Error("Got:", state.Status, state.PC, state.Steps, "Expected:", test.status, test.pc, 1)
+		}
+		if output := c.Output(); output != test.output {
+			t.Errorf("Got: %q Expected: %q", output, test.output)
+		}
+	}
+}
+
+func TestClientContinue(t *testing.T) {
+	c := testServer(t, "127.0.0.1:0", echo)
+
+	if err := c.Break(echoed); err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if err := c.Break(0); err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if err := c.Clear(0); err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if err := c.Input("hi"); err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	tests := []struct {
+		input  string
+		status string
+		pc     int
+		output string
+	}{
+		{"", StatusBreakpoint, echoed, ">hi\n"},
+		{"", StatusWaiting, 2, ">"},
+		{"yo\n", StatusBreakpoint, echoed, "yo\n"},
+	}
+
+	for _, test := range tests {
+		if test.input != "" {
+			c.Input(test.input)
+		}
+
+		state, err := c.Continue(0)
+		if err != nil {
+			t.Fatal("Got:", err, "Expected:", nil)
+		}
+		if state.Status != test.status || state.PC != test.pc {
+			t.Error("Got:", state.Status, state.PC, "Expected:", test.status, test.pc)
+		}
+		if !reflect.DeepEqual(state.Breakpoints, []uint16{echoed}) {
+			t.Error("Got:", state.Breakpoints, "Expected:", []uint16{echoed})
+		}
+		if output := c.Output(); output != test.output {
+			t.Errorf("Got: %q Expected: %q", output, test.output)
+		}
+	}
+
+	if state, _ := c.Continue(10); state.Status != "halted" {
+		t.Error("Got:", state.Status, "Expected:", "halted")
+	}
+}
+
+func TestClientContinueLimit(t *testing.T) {
+	c := testServer(t, "127.0.0.1:0", "loop: jmp loop")
+
+	state, err := c.Continue(25000)
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if state.Status != StatusPaused || state.Steps != 25000 {
+		t.Error("Got:", state.Status, state.Steps, "Expected:", StatusPaused, 25000)
+	}
+}
+
+func TestClientPause(t *testing.T) {
+	c := testServer(t, "127.0.0.1:0", "loop: jmp loop")
+	other := testClient(t, c.conn.RemoteAddr())
+
+	done := make(chan State, 1)
+	go func() {
+		state, _ := c.Continue(0)
+		done <- state
+	}()
+
+	// the pause has to land after the continue starts
+	for {
+		if _, err := other.Pause(); err != nil {
+			t.Fatal("Got:", err, "Expected:", nil)
+		}
+		select {
+		case state := <-done:
+			if state.Status != StatusPaused || state.Steps == 0 {
+				t.Error("Got:", state.Status, state.Steps, "Expected:", StatusPaused, "some steps")
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestClientWrites(t *testing.T) {
+	c := testServer(t, "127.0.0.1:0", echo)
+
+	if err := c.WriteMemory(30, []uint16{1, 2, 3}); err != nil {
+		t.Error("Got:", err, "Expected:", nil)
+	}
+	values, err := c.ReadMemory(29, 4)
+	if err != nil || !reflect.DeepEqual(values, []uint16{0, 1, 2, 3}) {
+		t.Error("Got:", values, err, "Expected:", []uint16{0, 1, 2, 3})
+	}
+
+	if err := c.WriteRegister(7, 5); err != nil {
+		t.Error("Got:", err, "Expected:", nil)
+	}
+	if err := c.WriteStack([]uint16{1, 2}); err != nil {
+		t.Error("Got:", err, "Expected:", nil)
+	}
+
+	state, err := c.State()
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if state.Registers[7] != 5 || !reflect.DeepEqual(state.Stack, []uint16{1, 2}) {
+		t.Error("Got:", state.Registers, state.Stack, "Expected:", "r7 5 and a stack of 1 2")
+	}
+
+	snapshot, err := c.Snapshot("test")
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if snapshot.Title != "test" || snapshot.Registers[7] != 5 || !reflect.DeepEqual(snapshot.Stack, []uint16{1, 2}) || snapshot.Image[31] != 2 {
+		t.Error("Got:", snapshot.Title, snapshot.Registers, snapshot.Stack, "Expected:", "the state written")
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c := testServer(t, "127.0.0.1:0", echo)
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"register 8", c.WriteRegister(8, 1), "no register 8"},
+		{"register too big", c.WriteRegister(0, 32768), "too big"},
+		{"read past memory", func() error { _, err := c.ReadMemory(32767, 2); return err }(), "past the end of memory"},
+		{"write past memory", c.WriteMemory(32767, []uint16{1, 2}), "past the end of memory"},
+		{"unknown command", func() error { _, err := c.Do(Request{Command: "jump"}); return err }(), `unknown command "jump"`},
+	}
+
+	for _, test := range tests {
+		if test.err == nil || !strings.Contains(test.err.Error(), test.want) {
+			t.Error("Got:", test.err, "Expected:", test.want, "For:", test.name)
+		}
+	}
+}
+
+func TestServerBadRequest(t *testing.T) {
+	c := testServer(t, "127.0.0.1:0", echo)
+
+	if _, err := c.conn.Write([]byte("{\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(c.conn).ReadString('\n')
+	if err != nil || !strings.Contains(line, "bad request") {
+		t.Error("Got:", line, err, "Expected:", "bad request")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "synacor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	address := "unix:" + filepath.Join(dir, "vm.sock")
+	testServer(t, address, echo)
+
+	c, err := Dial(address)
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	defer c.Close()
+
+	if state, err := c.State(); err != nil || state.Status != StatusPaused {
+		t.Error("Got:", state.Status, err, "Expected:", StatusPaused)
+	}
+}
@@ -0,0 +1,272 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pladdy/synacor"
+)
+
+// Instructions a continue runs before letting other connections in.
+const continueBatch = 10000
+
+// Server debugs a Machine for any number of connections.  Requests from
+// different connections take turns; a continue lets others in between batches
+// of instructions so they can look at the Machine or pause it.
+type Server struct {
+	m synacor.Machine
+
+	mu          sync.Mutex
+	breakpoints map[uint16]bool
+	// lines of input queued for the game
+	input  []string
+	output bytes.Buffer
+	status string
+
+	// set to 1 to stop a continue
+	paused int32
+}
+
+// NewServer returns a Server for m, which is paused.  The game's output is
+// sent to the client rather than written to stdout.
+func NewServer(m synacor.Machine) *Server {
+	s := &Server{m: m, breakpoints: make(map[uint16]bool), status: StatusPaused}
+	m.SetOutput(&s.output)
+	return s
+}
+
+// Serve accepts connections on l and serves them until l is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn answers requests from conn until it's closed.
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	// write-memory can send the whole image
+	scanner.Buffer(nil, 1<<20)
+	enc := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req Request
+		var resp Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = s.respond(req, fmt.Errorf("bad request: %v", err))
+		} else {
+			resp = s.Do(req)
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// Do runs a request and returns the response.
+func (s *Server) Do(req Request) Response {
+	switch req.Command {
+	case CommandContinue:
+		s.cont(req.Count)
+		return s.respond(req, nil)
+	case CommandPause:
+		atomic.StoreInt32(&s.paused, 1)
+		return s.respond(req, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	var values []uint16
+	var data []byte
+	switch req.Command {
+	case CommandState:
+	case CommandStep:
+		s.step(req.Count)
+	case CommandBreak:
+		s.breakpoints[req.Address] = true
+	case CommandClear:
+		delete(s.breakpoints, req.Address)
+	case CommandReadMemory:
+		if err = checkRange(req.Address, req.Count); err == nil {
+			values = make([]uint16, req.Count)
+			for i := range values {
+				values[i] = s.m.Memory(req.Address + uint16(i))
+			}
+		}
+	case CommandWriteMemory:
+		if err = checkRange(req.Address, uint64(len(req.Values))); err == nil {
+			for i, v := range req.Values {
+				s.m.SetMemory(req.Address+uint16(i), v)
+			}
+		}
+	case CommandWriteRegister:
+		err = s.writeRegister(req.Register, req.Value)
+	case CommandWriteStack:
+		s.m.SetStack(req.Values)
+	case CommandInput:
+		s.queue(req.Input)
+	case CommandSnapshot:
+		var b bytes.Buffer
+		if err = s.m.Snapshot(req.Title).Write(&b); err == nil {
+			data = b.Bytes()
+		}
+	default:
+		err = fmt.Errorf("unknown command %q", req.Command)
+	}
+
+	resp := s.locked(req, err)
+	resp.Values, resp.Data = values, data
+	return resp
+}
+
+// respond takes the lock and returns a response to req.
+func (s *Server) respond(req Request, err error) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locked(req, err)
+}
+
+// locked returns a response to req, with the lock held.
+func (s *Server) locked(req Request, err error) Response {
+	resp := Response{ID: req.ID, State: s.state(), Output: s.output.String()}
+	s.output.Reset()
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+func (s *Server) state() State {
+	state := State{
+		Status:      s.status,
+		PC:          s.m.PC(),
+		Steps:       s.m.Steps(),
+		Registers:   *s.m.Registers,
+		Stack:       append([]uint16{}, *s.m.Stack...),
+		Breakpoints: []uint16{},
+		Backtrace:   s.m.Backtrace(),
+	}
+	if f := s.m.Fault(); f != nil {
+		state.Fault = f.Error()
+	}
+
+	for a := range s.breakpoints {
+		state.Breakpoints = append(state.Breakpoints, a)
+	}
+	sort.Slice(state.Breakpoints, func(i, j int) bool { return state.Breakpoints[i] < state.Breakpoints[j] })
+	return state
+}
+
+// step executes n instructions, 1 if n is 0, ignoring breakpoints.
+func (s *Server) step(n uint64) {
+	if n == 0 {
+		n = 1
+	}
+
+	s.status = StatusPaused
+	for i := uint64(0); i < n; i++ {
+		if !s.next() {
+			break
+		}
+	}
+}
+
+// cont runs until a breakpoint, the Machine needs input or stops, it's paused
+// or it's executed limit instructions (0 is no limit).
+func (s *Server) cont(limit uint64) {
+	atomic.StoreInt32(&s.paused, 0)
+
+	// don't stop at the breakpoint it's sitting on
+	first := true
+	for n := uint64(0); ; {
+		s.mu.Lock()
+		for batch := 0; batch < continueBatch; batch, n = batch+1, n+1 {
+			switch {
+			case !first && s.breakpoints[uint16(s.m.PC())]:
+				s.status = StatusBreakpoint
+			case atomic.LoadInt32(&s.paused) == 1 || (limit > 0 && n >= limit):
+				s.status = StatusPaused
+			case s.next():
+				first = false
+				continue
+			}
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+	}
+}
+
+// next executes the next instruction, giving the game a line of input first
+// if it's waiting for one.  It returns false, and sets the status, if the
+// Machine can't go on without something from the client.
+func (s *Server) next() bool {
+	if s.m.WaitingForInput() {
+		if len(s.input) == 0 {
+			s.status = StatusWaiting
+			return false
+		}
+		s.m.SetInput(strings.NewReader(s.input[0]))
+		s.input = s.input[1:]
+	}
+	s.m.Step()
+
+	if stop := s.m.Stopped(); stop != synacor.NotStopped {
+		s.status = stop.String()
+		return false
+	}
+	return true
+}
+
+// queue adds input for the game, a line at a time; a last line without a
+// newline gets one.
+func (s *Server) queue(input string) {
+	for _, line := range strings.SplitAfter(input, "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		s.input = append(s.input, line)
+	}
+	if s.status == StatusWaiting {
+		s.status = StatusPaused
+	}
+}
+
+func (s *Server) writeRegister(n int, value uint16) error {
+	if n < 0 || n > 7 {
+		return fmt.Errorf("no register %d, there are 0 through 7", n)
+	}
+	if value > 32767 {
+		return fmt.Errorf("%d is too big for a register", value)
+	}
+	s.m.SetRegister(n, value)
+	return nil
+}
+
+// checkRange returns an error if count words from address run past the end
+// of the address space.
+func checkRange(address uint16, count uint64) error {
+	if uint64(address)+count > 32768 {
+		return fmt.Errorf("%d words from %d run past the end of memory", count, address)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package synacor
+
+import "sort"
+
+// SourceMap maps addresses to the lines of the assembly or disassembly listing
+// they came from.  Lines are numbered from 1.
+type SourceMap struct {
+	// addresses in order, and the line each starts on
+	addresses []uint16
+	lines     []int
+}
+
+// add maps an address to a line; addresses have to be added in order.
+func (s *SourceMap) add(address uint16, line int) {
+	s.addresses = append(s.addresses, address)
+	s.lines = append(s.lines, line)
+}
+
+// Line returns the line of the instruction at an address, or the one before it
+// if the address is in the middle of an instruction.
+func (s SourceMap) Line(address uint16) (int, bool) {
+	i := sort.Search(len(s.addresses), func(i int) bool { return s.addresses[i] > address })
+	if i == 0 {
+		return 0, false
+	}
+	return s.lines[i-1], true
+}
+
+// Address returns the address of the first instruction on a line, or on the
+// next line with an instruction, and the line it's on.
+func (s SourceMap) Address(line int) (uint16, int, bool) {
+	i := sort.SearchInts(s.lines, line)
+	if i == len(s.lines) {
+		return 0, 0, false
+	}
+	return s.addresses[i], s.lines[i], true
+}
@@ -0,0 +1,85 @@
+package synacor
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAssembleSource(t *testing.T) {
+	src := `# a comment
+start: out 'a'; out 'b'
+
+	jmp start
+	data 1 2
+`
+	_, lines, err := AssembleSource(src, 10, nil)
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	tests := []struct {
+		address uint16
+		line    int
+		ok      bool
+	}{
+		{9, 0, false},
+		{10, 2, true},
+		{11, 2, true},
+		{12, 2, true},
+		{14, 4, true},
+		{16, 5, true},
+		{20, 5, true},
+	}
+
+	for _, test := range tests {
+		line, ok := lines.Line(test.address)
+		if line != test.line || ok != test.ok {
+			t.Error("Got:", line, ok, "Expected:", test.line, test.ok, "For:", test.address)
+		}
+	}
+}
+
+func TestSourceMapAddress(t *testing.T) {
+	_, lines, err := AssembleSource("out 'a'\n\n# comment\nhalt\n", 0, nil)
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	tests := []struct {
+		line, address, moved int
+		ok                   bool
+	}{
+		{1, 0, 1, true},
+		{2, 2, 4, true},
+		{4, 2, 4, true},
+		{5, 0, 0, false},
+	}
+
+	for _, test := range tests {
+		address, line, ok := lines.Address(test.line)
+		if int(address) != test.address || line != test.moved || ok != test.ok {
+			t.Error("Got:", address, line, ok, "Expected:", test.address, test.moved, test.ok, "For:", test.line)
+		}
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 3, Type: Label, Name: "done"})
+
+	var b bytes.Buffer
+	lines, err := WriteListing(&b, []uint16{uint16(opOut), 'T', uint16(opNoop), uint16(opHalt)}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the symbol takes a blank line and its own
+	for address, expected := range map[uint16]int{0: 1, 2: 2, 3: 5} {
+		if line, _ := lines.Line(address); line != expected {
+			t.Error("Got:", line, "Expected:", expected, "For:", address)
+		}
+	}
+	if b.String() != "       0  out 'T'\n       2  noop\n\ndone: ; label \n       3  halt\n" {
+		t.Errorf("Got: %q", b.String())
+	}
+}
@@ -0,0 +1,67 @@
+package synacor
+
+// FoundString is a string found in memory.
+type FoundString struct {
+	Address uint16
+	Text    string
+	// Prefixed is true when the string is stored as its length followed by its
+	// characters, false when it's characters ending in a 0.
+	Prefixed bool
+}
+
+// FindStrings scans memory for length prefixed and null terminated strings of
+// printable characters that are at least min characters long.
+func FindStrings(memory []uint16, min int) []FoundString {
+	found := []FoundString{}
+
+	for a := 0; a < len(memory); {
+		if s, ok := prefixedString(memory, a, min); ok {
+			found = append(found, FoundString{uint16(a), s, true})
+			a += len(s) + 1
+			continue
+		}
+		if s, ok := terminatedString(memory, a, min); ok {
+			found = append(found, FoundString{uint16(a), s, false})
+			a += len(s) + 1
+			continue
+		}
+		a++
+	}
+	return found
+}
+
+func isPrintable(u uint16) bool {
+	return u == '\n' || (u >= ' ' && u <= '~')
+}
+
+func prefixedString(memory []uint16, a, min int) (string, bool) {
+	n := int(memory[a])
+	if n < min || a+n >= len(memory) {
+		return "", false
+	}
+
+	chars := make([]byte, n)
+	for i := 0; i < n; i++ {
+		c := memory[a+1+i]
+		if !isPrintable(c) {
+			return "", false
+		}
+		chars[i] = byte(c)
+	}
+	return string(chars), true
+}
+
+func terminatedString(memory []uint16, a, min int) (string, bool) {
+	chars := []byte{}
+	for i := a; i < len(memory); i++ {
+		c := memory[i]
+		if c == 0 {
+			return string(chars), len(chars) >= min
+		}
+		if !isPrintable(c) {
+			return "", false
+		}
+		chars = append(chars, byte(c))
+	}
+	return "", false
+}
@@ -0,0 +1,88 @@
+package synacor
+
+import (
+	"bytes"
+	"testing"
+)
+
+func chars(s string) []uint16 {
+	u := []uint16{}
+	for _, c := range s {
+		u = append(u, uint16(c))
+	}
+	return u
+}
+
+func TestFindStrings(t *testing.T) {
+	memory := []uint16{uint16(opNoop), 5}
+	memory = append(memory, chars("Hello")...)
+	memory = append(memory, uint16(opHalt), 19, 1)
+	memory = append(memory, chars("abc\ndef")...)
+	memory = append(memory, 0, 3)
+	memory = append(memory, chars("no")...)
+	memory = append(memory, 0)
+
+	expected := []FoundString{
+		{1, "Hello", true},
+		{10, "abc\ndef", false},
+	}
+
+	result := FindStrings(memory, 3)
+	if len(result) != len(expected) {
+		t.Fatal("Got:", result, "Expected:", expected)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Error("Got:", result[i], "Expected:", expected[i])
+		}
+	}
+}
+
+func TestMachineRunUntilInput(t *testing.T) {
+	// decodes the string at 25 by adding 1 to every character, then waits for
+	// input
+	memory := []uint16{
+		uint16(opSet), register1, 25,
+		uint16(opRmem), register0, register1,
+		uint16(opJf), register0, 22,
+		uint16(opAdd), register0, register0, 1,
+		uint16(opWmem), register1, register0,
+		uint16(opAdd), register1, register1, 1,
+		uint16(opJmp), 3,
+		uint16(opIn), register2,
+		uint16(opHalt),
+	}
+	for _, c := range "Gdkkn" {
+		memory = append(memory, uint16(c-1))
+	}
+	memory = append(memory, 0)
+
+	m := newTestMachine(memory)
+	if stop := m.RunUntilInput(0); stop != WaitingForInput {
+		t.Fatal("Got:", stop, "Expected:", WaitingForInput)
+	}
+	if m.PC() != 22 {
+		t.Error("Got:", m.PC(), "Expected:", 22)
+	}
+
+	found := FindStrings(m.Image(), 4)
+	if len(found) != 1 || found[0] != (FoundString{25, "Gdkkn", false}) {
+		t.Error("Got:", found, "Expected:", "Gdkkn at 25")
+	}
+
+	if stop := newTestMachine(memory).RunUntilInput(10); stop != StepLimit {
+		t.Error("Got:", stop, "Expected:", StepLimit)
+	}
+}
+
+func TestMachineWriteImage(t *testing.T) {
+	var b bytes.Buffer
+	if err := newTestMachine([]uint16{19, 84, 0}).WriteImage(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{19, 0, 84, 0, 0, 0}
+	if !bytes.Equal(b.Bytes(), expected) {
+		t.Error("Got:", b.Bytes(), "Expected:", expected)
+	}
+}
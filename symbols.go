@@ -0,0 +1,197 @@
+package synacor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SymbolType is what's found at a symbol's address.
+type SymbolType string
+
+// Types of symbols.
+const (
+	Function SymbolType = "function"
+	Label    SymbolType = "label"
+	String   SymbolType = "string"
+	Data     SymbolType = "data"
+)
+
+var symbolTypes = map[SymbolType]bool{Function: true, Label: true, String: true, Data: true}
+
+// Symbol names an address in a program.
+type Symbol struct {
+	Address uint16
+	Type    SymbolType
+	Name    string
+	Comment string
+}
+
+// Symbols are the named addresses of a program.  A symbols file has one symbol
+// per line:
+//
+//	<address> <type> <name> [comment]
+//
+// where type is function, label, string or data.  Blank lines and lines
+// starting with '#' are ignored.
+type Symbols struct {
+	byAddress map[uint16]Symbol
+	functions []uint16
+}
+
+// NewSymbols returns an empty set of Symbols.
+func NewSymbols() *Symbols {
+	return &Symbols{byAddress: make(map[uint16]Symbol)}
+}
+
+// LoadSymbols reads a symbols file.
+func LoadSymbols(file string) (*Symbols, error) {
+	fh, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	return ParseSymbols(fh)
+}
+
+// ParseSymbols reads symbols in the symbols file format from r.
+func ParseSymbols(r io.Reader) (*Symbols, error) {
+	s := NewSymbols()
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected '<address> <type> <name> [comment]'", line)
+		}
+
+		address, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil || address > maxMemory {
+			return nil, fmt.Errorf("line %d: bad address %q", line, fields[0])
+		}
+
+		t := SymbolType(fields[1])
+		if !symbolTypes[t] {
+			return nil, fmt.Errorf("line %d: bad type %q", line, fields[1])
+		}
+
+		s.Add(Symbol{
+			Address: uint16(address),
+			Type:    t,
+			Name:    fields[2],
+			Comment: strings.Join(fields[3:], " "),
+		})
+	}
+	return s, scanner.Err()
+}
+
+// Add a symbol, replacing any symbol already at its address.
+func (s *Symbols) Add(sym Symbol) {
+	if old, ok := s.byAddress[sym.Address]; ok && old.Type == Function {
+		s.removeFunction(old.Address)
+	}
+	s.byAddress[sym.Address] = sym
+
+	if sym.Type == Function {
+		i := sort.Search(len(s.functions), func(i int) bool { return s.functions[i] >= sym.Address })
+		s.functions = append(s.functions, 0)
+		copy(s.functions[i+1:], s.functions[i:])
+		s.functions[i] = sym.Address
+	}
+}
+
+func (s *Symbols) removeFunction(address uint16) {
+	for i, a := range s.functions {
+		if a == address {
+			s.functions = append(s.functions[:i], s.functions[i+1:]...)
+			return
+		}
+	}
+}
+
+// Write writes the symbols in the symbols file format.
+func (s *Symbols) Write(w io.Writer) error {
+	for _, sym := range s.All() {
+		line := fmt.Sprintf("%d %s %s %s", sym.Address, sym.Type, sym.Name, sym.Comment)
+		if _, err := fmt.Fprintln(w, strings.TrimSpace(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup returns the symbol at an address.
+func (s *Symbols) Lookup(address uint16) (Symbol, bool) {
+	if s == nil {
+		return Symbol{}, false
+	}
+	sym, ok := s.byAddress[address]
+	return sym, ok
+}
+
+// byName returns the symbol with a name.
+func (s *Symbols) byName(name string) (Symbol, bool) {
+	if s == nil {
+		return Symbol{}, false
+	}
+	for _, sym := range s.byAddress {
+		if sym.Name == name {
+			return sym, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// All returns every symbol ordered by address.
+func (s *Symbols) All() []Symbol {
+	all := []Symbol{}
+	if s == nil {
+		return all
+	}
+
+	for _, sym := range s.byAddress {
+		all = append(all, sym)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Address < all[j].Address })
+	return all
+}
+
+// Name returns how to refer to an address: the name of its symbol, an offset
+// into the function before it (like confirm_teleporter+3), or the address.
+func (s *Symbols) Name(address uint16) string {
+	if s == nil {
+		return strconv.Itoa(int(address))
+	}
+	if sym, ok := s.byAddress[address]; ok {
+		return sym.Name
+	}
+
+	i := sort.Search(len(s.functions), func(i int) bool { return s.functions[i] > address })
+	if i == 0 {
+		return strconv.Itoa(int(address))
+	}
+	f := s.byAddress[s.functions[i-1]]
+	return fmt.Sprintf("%s+%d", f.Name, address-f.Address)
+}
+
+// label prints as the name of an address; formatting is left until a trace
+// actually writes it.
+type label struct {
+	symbols *Symbols
+	address uint16
+}
+
+func (l label) String() string {
+	return l.symbols.Name(l.address)
+}
@@ -0,0 +1,155 @@
+package synacor
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testSymbols = `# a comment
+
+10 function confirm_teleporter checks the eighth register
+20 string greeting
+ 30 data   counter
+40 label loop
+`
+
+func TestParseSymbols(t *testing.T) {
+	s, err := ParseSymbols(strings.NewReader(testSymbols))
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+
+	expected := []Symbol{
+		{10, Function, "confirm_teleporter", "checks the eighth register"},
+		{20, String, "greeting", ""},
+		{30, Data, "counter", ""},
+		{40, Label, "loop", ""},
+	}
+
+	all := s.All()
+	if len(all) != len(expected) {
+		t.Fatal("Got:", all, "Expected:", expected)
+	}
+	for i := range expected {
+		if all[i] != expected[i] {
+			t.Error("Got:", all[i], "Expected:", expected[i])
+		}
+	}
+}
+
+func TestParseSymbolsErrors(t *testing.T) {
+	tests := []string{
+		"10 function",
+		"abc function name",
+		"40000 function name",
+		"10 thing name",
+	}
+
+	for _, test := range tests {
+		if _, err := ParseSymbols(strings.NewReader(test)); err == nil {
+			t.Error("Expected an error for:", test)
+		}
+	}
+}
+
+func TestLoadSymbols(t *testing.T) {
+	file, err := os.Create("test.sym")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("test.sym")
+
+	file.WriteString(testSymbols)
+	file.Close()
+
+	s, err := LoadSymbols("test.sym")
+	if err != nil {
+		t.Fatal("Got:", err, "Expected:", nil)
+	}
+	if len(s.All()) != 4 {
+		t.Error("Got:", len(s.All()), "Expected:", 4)
+	}
+
+	if _, err := LoadSymbols("missing.sym"); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestSymbolsName(t *testing.T) {
+	s, err := ParseSymbols(strings.NewReader(testSymbols))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		symbols  *Symbols
+		address  uint16
+		expected string
+	}{
+		{s, 5, "5"},
+		{s, 10, "confirm_teleporter"},
+		{s, 17, "confirm_teleporter+7"},
+		{s, 20, "greeting"},
+		{s, 21, "confirm_teleporter+11"},
+		{s, 40, "loop"},
+		{nil, 10, "10"},
+	}
+
+	for _, test := range tests {
+		result := test.symbols.Name(test.address)
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected)
+		}
+	}
+}
+
+func TestSymbolsAdd(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 10, Type: Function, Name: "first"})
+	s.Add(Symbol{Address: 5, Type: Function, Name: "zeroth"})
+	s.Add(Symbol{Address: 10, Type: Data, Name: "table"})
+
+	if name := s.Name(12); name != "zeroth+7" {
+		t.Error("Got:", name, "Expected:", "zeroth+7")
+	}
+	if sym, ok := s.Lookup(10); !ok || sym.Name != "table" {
+		t.Error("Got:", sym, "Expected:", "table")
+	}
+}
+
+func TestMachineTraceSymbols(t *testing.T) {
+	s := NewSymbols()
+	s.Add(Symbol{Address: 2, Type: Function, Name: "greet"})
+
+	var trace bytes.Buffer
+	m := newTestMachine([]uint16{uint16(opCall), 2, uint16(opNoop), uint16(opHalt)})
+	m.SetSymbols(s)
+	m.SetTrace(&trace)
+	m.RunSteps(0)
+
+	expected := []string{"0 call (17) op args: greet, Stack Push: greet", "greet noop (21)", "greet+1 halt (0)"}
+	for _, e := range expected {
+		if !strings.Contains(trace.String(), e) {
+			t.Error("Got:", trace.String(), "Expected:", e)
+		}
+	}
+}
+
+func TestSymbolsWrite(t *testing.T) {
+	s, err := ParseSymbols(strings.NewReader(testSymbols))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := s.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "10 function confirm_teleporter checks the eighth register\n20 string greeting\n30 data counter\n40 label loop\n"
+	if b.String() != expected {
+		t.Error("Got:", b.String(), "Expected:", expected)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"strings"
 )
 
@@ -34,9 +33,38 @@ type Machine struct {
 	Registers *registers
 }
 
-// NewMachine returns a new Machine type.
+// NewMachine returns a new Machine type.  It reads input from stdin, writes
+// output to stdout and traces every operation to stderr.
 func NewMachine() Machine {
-	return Machine{&program{}, &stack{}, &registers{}}
+	return Machine{&program{trace: os.Stderr}, &stack{}, &registers{}}
+}
+
+// Clone returns a copy of the Machine.  The copy shares memory with the
+// original until either one of them writes to it.  The copy has no input,
+// output or trace set.
+func (m Machine) Clone() Machine {
+	p := *m.Program
+	p.shared = true
+	p.input = append([]uint16(nil), m.Program.input...)
+	p.calls = append([]Frame(nil), m.Program.calls...)
+	p.hooks = make(map[uint16]Hook, len(m.Program.hooks))
+	for a, h := range m.Program.hooks {
+		p.hooks[a] = h
+	}
+	p.reader = nil
+	p.output = nil
+	p.trace = nil
+	p.codes = nil
+	p.commands = nil
+	p.debugger = nil
+	p.cache = nil
+	p.checkpoints = nil
+	m.Program.shared = true
+
+	s := append(stack(nil), *m.Stack...)
+	r := *m.Registers
+
+	return Machine{&p, &s, &r}
 }
 
 // HasMoreOps returns true if Machine has more operations to run.
@@ -47,26 +75,163 @@ func (m Machine) HasMoreOps() bool {
 	return false
 }
 
-// Load takes a path to a binary and loads it into the Machine
-func (m Machine) Load(s string) {
-	m.Program.load(s)
+// Image returns a copy of the Machine's memory.
+func (m Machine) Image() []uint16 {
+	return append([]uint16(nil), m.Program.memory...)
+}
+
+// WriteImage writes the Machine's memory as a binary the Machine can load.
+func (m Machine) WriteImage(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, m.Program.memory)
+}
+
+// Load takes a path to a binary and loads it into the Machine.  The binary can
+// be a raw image or a Container, whose entry point, registers, symbols and
+// stack are loaded too.
+func (m Machine) Load(s string) error {
+	c, err := LoadProgram(s)
+	if err != nil {
+		return err
+	}
+	m.LoadContainer(c)
+	return nil
+}
+
+// LoadContainer loads a program that's already been read, along with its entry
+// point, registers, symbols and stack.
+func (m Machine) LoadContainer(c Container) {
+	m.Program.loadContainer(c)
+	*m.Registers = c.Registers
+	*m.Stack = append(stack(nil), c.Stack...)
+}
+
+// Snapshot returns the Machine's state as a Container; loading it carries on
+// from where the Machine is now.  Input already read but not used yet isn't
+// part of it.
+func (m Machine) Snapshot(title string) Container {
+	return Container{
+		Title:     title,
+		Entry:     uint16(m.PC()),
+		Registers: *m.Registers,
+		Symbols:   m.Program.symbols,
+		Image:     m.Image(),
+		Stack:     append([]uint16(nil), *m.Stack...),
+	}
 }
 
 // NextOp returns the
 //   - name of the next operation
 //   - code of the next operation
 //   - arguments for the next operation
+//
+// The name is empty, and there are no arguments, when the word isn't an
+// operation or its arguments run past the end of memory.
 func (m Machine) NextOp() (name string, opCode uint16, args []uint16) {
 	p := m.Program
-	oc := opcode(p.memory[p.index])
-	properties := operatorPropertyMap[oc]
+	i := Decode(p.memory, uint16(p.index))
+	p.index = p.index + i.Size()
 
-	for i := 0; i < properties.args; i++ {
-		args = append(args, p.getNextRaw())
-	}
-	p.index = p.index + 1
+	return i.Name, i.Opcode, i.Args
+}
 
-	return properties.name, uint16(oc), args
+// Decode returns the instruction at an address in memory.
+func (m Machine) Decode(address uint16) Instruction {
+	return Decode(m.Program.memory, address)
+}
+
+// Memory returns the value at an address in memory; addresses past the end of
+// the loaded program are 0.
+func (m Machine) Memory(address uint16) uint16 {
+	return m.Program.read(address)
+}
+
+// SetMemory writes a value to an address in memory.
+func (m Machine) SetMemory(address, value uint16) {
+	m.Program.write(address, value)
+}
+
+// PC returns the address of the next instruction.
+func (m Machine) PC() int {
+	return m.Program.index
+}
+
+// Register returns the value of register n (0 through 7).
+func (m Machine) Register(n int) uint16 {
+	return m.Registers[n]
+}
+
+// SetRegister sets register n (0 through 7) to a value.
+func (m Machine) SetRegister(n int, value uint16) {
+	m.Registers[n] = value
+}
+
+// SetStack replaces the stack with values, the top of the stack last.
+func (m Machine) SetStack(values []uint16) {
+	*m.Stack = append(stack(nil), values...)
+}
+
+// SetCommands has every line of input go to handle first; lines it returns
+// true for are not passed on to the program.
+func (m Machine) SetCommands(handle func(line string) bool) {
+	m.Program.commands = handle
+}
+
+// SetDebugger has Run call debug before every instruction, where it can stop
+// to look at the Machine or change it.
+func (m Machine) SetDebugger(debug func()) {
+	m.Program.debugger = debug
+}
+
+// SetInput has the Machine read input from r instead of stdin.
+func (m Machine) SetInput(r io.Reader) {
+	m.Program.reader = bufio.NewReader(r)
+}
+
+// SetOutput has the Machine write output to w instead of stdout.
+func (m Machine) SetOutput(w io.Writer) {
+	m.Program.output = w
+}
+
+// SetStackLimit has the Machine fault when the stack gets deeper than n; 0 is
+// no limit.
+func (m Machine) SetStackLimit(n int) {
+	m.Program.stackLimit = n
+}
+
+// Symbols returns the Machine's symbols, nil if it has none.
+func (m Machine) Symbols() *Symbols {
+	return m.Program.symbols
+}
+
+// SetSymbols gives the Machine names for addresses to use in its trace.
+func (m Machine) SetSymbols(s *Symbols) {
+	m.Program.symbols = s
+}
+
+// SetTrace has the Machine trace operations to w; nil turns tracing off.
+func (m Machine) SetTrace(w io.Writer) {
+	m.Program.trace = w
+}
+
+// Steps returns how many instructions the Machine has executed.
+func (m Machine) Steps() uint64 {
+	return m.Program.steps
+}
+
+// Stopped returns why the Machine stopped, or NotStopped if it can keep
+// running.
+func (m Machine) Stopped() StopReason {
+	return m.Program.stop
+}
+
+// Fault returns the fault that stopped the Machine, if it faulted.
+func (m Machine) Fault() *Fault {
+	return m.Program.faulted
+}
+
+// WatchCodes has the Machine pass everything it outputs to a CodeWatcher.
+func (m Machine) WatchCodes(c *CodeWatcher) {
+	m.Program.codes = c
 }
 
 // Run the loaded program.
@@ -82,7 +247,7 @@ func (m Machine) Run() {
 	hackedCallAcker := false
 
 	p := m.Program
-	for p.index < len(p.memory) {
+	for p.stop == NotStopped {
 
 		if p.index > hackEndOfRegisterTests && hackedEndOfRegisterTests == false {
 			// run `make teleporter` and result is entered here
@@ -107,28 +272,185 @@ func (m Machine) Run() {
 			hackedSetReg = true
 		}
 
-		v := opcode(p.memory[p.index])
-		ops := operatorPropertyMap[v]
-
-		fmt.Fprintf(os.Stderr, "%d %s (%d) ", p.index, ops.name, v)
-
-		operatorFunctionMap[v](p, m.Registers, m.Stack)
-
-		fmt.Fprintf(os.Stderr, " Stack: %d, Registers: %d", m.Stack, m.Registers)
-		fmt.Fprintf(os.Stderr, " Input: '%s'\n", inputToString(p.input))
+		if p.debugger != nil {
+			p.debugger()
+		}
+		m.Step()
 
 		// custom debug statements
 		// first char typed into stdin gets set in a register...
 		if strings.Contains(inputToString(p.input), "se teleporter") {
-			fmt.Fprintln(os.Stderr, "  'use teleporter' called")
+			p.tracef("  'use teleporter' called\n")
+		}
+	}
+}
+
+// RunSteps runs the loaded program, without any of the hacks in Run, until it
+// stops or has executed limit more instructions (0 means no limit).  It returns
+// why it stopped, StepLimit if it ran out of instructions.
+func (m Machine) RunSteps(limit uint64) StopReason {
+	p := m.Program
+	for n := uint64(0); p.stop == NotStopped; n++ {
+		if limit > 0 && n >= limit {
+			return StepLimit
+		}
+		m.Step()
+	}
+	return p.stop
+}
+
+// RunUntilInput runs the loaded program, without any of the hacks in Run, until
+// it's about to wait for input, stops or has executed limit more instructions
+// (0 means no limit).  It returns WaitingForInput if it's waiting for input.
+func (m Machine) RunUntilInput(limit uint64) StopReason {
+	p := m.Program
+	for n := uint64(0); p.stop == NotStopped; n++ {
+		if m.WaitingForInput() {
+			return WaitingForInput
 		}
+		if limit > 0 && n >= limit {
+			return StepLimit
+		}
+		m.Step()
 	}
+	return p.stop
+}
+
+// WaitingForInput returns true if the next instruction is an in and there's
+// no input left from the last line read, so it would read another line.
+func (m Machine) WaitingForInput() bool {
+	p := m.Program
+	return p.index < len(p.memory) && opcode(p.memory[p.index]) == opIn && len(p.input) == 0
+}
+
+// Step executes the next instruction.
+func (m Machine) Step() {
+	p := m.Program
+	if p.stop != NotStopped {
+		return
+	}
+	if p.index >= len(p.memory) {
+		p.stop = EndOfProgram
+		return
+	}
+
+	p.start = p.index
+	if !p.decodes() {
+		m.faulted()
+		return
+	}
+
+	v := opcode(p.memory[p.index])
+	ops := operatorPropertyMap[v]
+
+	p.tracef("%v %s (%d) ", p.label(uint16(p.index)), ops.name, v)
+
+	operatorFunctionMap[v](p, m.Registers, m.Stack)
+	if p.stop == Faulted {
+		// the operation may have moved on past the operands it read
+		p.index = p.start
+		m.faulted()
+		return
+	}
+	p.steps++
+	if p.checkpoints != nil {
+		p.checkpoints.record(p, m.Registers, m.Stack, uint16(p.start), v)
+	}
+
+	p.tracef(" Stack: %d, Registers: %d", m.Stack, m.Registers)
+	p.tracef(" Input: '%s'\n", inputToString(p.input))
+
+	if p.stop == NotStopped && p.index >= len(p.memory) {
+		p.stop = EndOfProgram
+	}
+}
+
+// faulted adds where the program was to the fault that stopped it, and traces
+// it.
+func (m Machine) faulted() {
+	f := m.Program.faulted
+	f.Backtrace = m.Backtrace()
+	f.symbols = m.Program.symbols
+	m.Program.tracef("%v\n", f)
+}
+
+// StopReason is why a Machine stopped running.
+type StopReason int
+
+// Reasons a Machine stops.
+const (
+	NotStopped StopReason = iota
+	Halted
+	EndOfProgram
+	InputExhausted
+	StepLimit
+	WaitingForInput
+	Faulted
+)
+
+var stopReasonNames = map[StopReason]string{
+	NotStopped:      "not stopped",
+	Halted:          "halted",
+	EndOfProgram:    "end of program",
+	InputExhausted:  "input exhausted",
+	StepLimit:       "step limit",
+	WaitingForInput: "waiting for input",
+	Faulted:         "faulted",
+}
+
+func (s StopReason) String() string {
+	return stopReasonNames[s]
+}
+
+// Fault is an error in the program being run, like popping an empty stack.
+type Fault struct {
+	Address     uint16
+	Instruction Instruction
+	Reason      string
+	// Backtrace is the calls the program was in
+	Backtrace Backtrace
+
+	// names functions in the backtrace
+	symbols *Symbols
+}
+
+func (f *Fault) Error() string {
+	msg := fmt.Sprintf("fault at %d (%s): %s", f.Address, f.Instruction, f.Reason)
+	if len(f.Backtrace) > 0 {
+		msg += " in " + f.Backtrace.chain(f.symbols, len(f.Backtrace))
+	}
+	return msg
 }
 
 type program struct {
-	index  int
-	memory []uint16
-	input  []uint16
+	index    int
+	memory   []uint16
+	input    []uint16
+	reader   *bufio.Reader
+	steps    uint64
+	stop     StopReason
+	faulted  *Fault
+	codes    *CodeWatcher
+	commands func(line string) bool
+	debugger func()
+	symbols  *Symbols
+	output   io.Writer
+	trace    io.Writer
+
+	// address of the instruction being executed
+	start int
+	// how deep the stack can get; 0 is no limit
+	stackLimit int
+	// memory is shared with a clone and has to be copied before writing
+	shared bool
+	// calls not returned from yet, outermost first
+	calls []Frame
+	// native replacements for functions, by address
+	hooks map[uint16]Hook
+	// blocks decoded by RunCached
+	cache *blockCache
+	// where to write checkpoints of the program's state
+	checkpoints *CheckpointLog
 }
 
 // This returns the value and shifts the provided index
@@ -151,39 +473,154 @@ func (p *program) getNextRaw() uint16 {
 }
 
 func (p *program) getChars() error {
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
-	if err != nil {
-		return err
+	// keep one reader around; a new reader per line would drop anything it
+	// buffered past the newline, like the rest of a file piped to stdin
+	if p.reader == nil {
+		p.reader = bufio.NewReader(os.Stdin)
+	}
+
+	for {
+		// a last line without a newline is still input
+		input, err := p.reader.ReadString('\n')
+		if err != nil && input == "" {
+			return err
+		}
+
+		// lines handled as commands never reach the program
+		if p.commands != nil && p.commands(input) {
+			continue
+		}
+
+		for _, c := range input {
+			p.input = append(p.input, uint16(c))
+		}
+		// fmt.Println("Input captured")
+		return nil
 	}
+}
 
-	for _, c := range input {
-		p.input = append(p.input, uint16(c))
+func (p *program) loadContainer(c Container) {
+	p.memory = c.Image
+	p.index = int(c.Entry)
+	p.shared = false
+	p.calls = nil
+	p.cache = nil
+	if p.checkpoints != nil {
+		p.checkpoints.start(p)
+	}
+	if c.Symbols != nil {
+		p.symbols = c.Symbols
 	}
-	// fmt.Println("Input captured")
-	return nil
 }
 
-func (p *program) load(file string) {
-	fh, err := os.Open(filepath.Clean(file))
-	if err != nil {
-		panic(err)
+// decodes faults and returns false if the word at the index isn't an operation
+// that can run: an unknown opcode, operands past the end of memory or operands
+// that aren't numbers or registers.
+func (p *program) decodes() bool {
+	word := p.memory[p.index]
+	properties, ok := operatorPropertyMap[opcode(word)]
+	if !ok || word > uint16(opNoop) {
+		p.fault(fmt.Sprintf("unknown opcode %d", word))
+		return false
 	}
 
-	reader := bufio.NewReader(fh)
-	i := 0
-	for {
-		le, err := readNext(reader)
-		if err == io.EOF {
-			break
+	end := p.index + 1 + properties.args
+	if end > len(p.memory) {
+		p.fault("operands run past the end of memory")
+		return false
+	}
+
+	for _, a := range p.memory[p.index+1 : end] {
+		if !isValid(a) {
+			p.fault(fmt.Sprintf("invalid operand %d", a))
+			return false
 		}
-		p.memory = append(p.memory, le)
-		i = i + 1
 	}
+	return true
+}
 
-	if err := fh.Close(); err != nil {
-		panic(err)
+// out returns where output goes, stdout unless it's been set.
+func (p *program) out() io.Writer {
+	if p.output == nil {
+		return os.Stdout
+	}
+	return p.output
+}
+
+// fault stops the program because of an error in the instruction being
+// executed, leaving the index at that instruction.
+func (p *program) fault(reason string) {
+	p.faulted = &Fault{
+		Address:     uint16(p.start),
+		Instruction: Decode(p.memory, uint16(p.start)),
+		Reason:      reason,
+	}
+	p.stop = Faulted
+	p.index = p.start
+}
+
+// stackFull faults and returns true if pushing to the stack would take it past
+// the stack limit.
+func (p *program) stackFull(s *stack) bool {
+	if p.stackLimit > 0 && len(*s) >= p.stackLimit {
+		p.fault(fmt.Sprintf("stack overflow, more than %d deep", p.stackLimit))
+		return true
+	}
+	return false
+}
+
+// label returns something that prints as the name of an address.
+func (p *program) label(address uint16) label {
+	return label{p.symbols, address}
+}
+
+// tracef writes to the trace, if there is one.
+func (p *program) tracef(format string, a ...interface{}) {
+	if p.trace != nil {
+		fmt.Fprintf(p.trace, format, a...)
+	}
+}
+
+// read returns memory at an address; addresses past the end of the loaded
+// program are 0.
+func (p *program) read(address uint16) uint16 {
+	if int(address) >= len(p.memory) {
+		return 0
+	}
+	return p.memory[address]
+}
+
+// write sets memory at an address, copying memory first if it's shared and
+// growing it if the address is past the end of the loaded program.
+func (p *program) write(address, value uint16) {
+	if p.shared {
+		p.memory = append([]uint16(nil), p.memory...)
+		p.shared = false
+	}
+	if p.checkpoints != nil {
+		p.checkpoints.wrote(address, p.read(address), value)
+	}
+	if int(address) >= len(p.memory) {
+		p.memory = append(p.memory, make([]uint16, int(address)+1-len(p.memory))...)
+	}
+	p.memory[address] = value
+	if p.cache != nil {
+		p.cache.invalidate(address)
+	}
+}
+
+// store writes a value to register <a>, faulting if <a> isn't a register or the
+// value isn't a number.
+func (p *program) store(r *registers, a, value uint16) {
+	if !isRegister(a) {
+		p.fault(fmt.Sprintf("%d is not a register", a))
+		return
+	}
+	if !isLiteralValue(value) {
+		p.fault(fmt.Sprintf("%d is not a number", value))
+		return
 	}
+	r.set(a, value)
 }
 
 type registers [8]uint16
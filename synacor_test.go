@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -98,6 +101,24 @@ func TestMachineRun(t *testing.T) {
 	m.Run()
 }
 
+func TestMachineSetDebugger(t *testing.T) {
+	m := newTestMachine([]uint16{uint16(opNoop), uint16(opSet), register0, 1, uint16(opHalt)})
+
+	addresses := []int{}
+	m.SetDebugger(func() {
+		addresses = append(addresses, m.PC())
+		// the debugger can change the Machine before the instruction runs
+		if m.PC() == 4 {
+			m.SetRegister(0, 2)
+		}
+	})
+	m.Run()
+
+	if !reflect.DeepEqual(addresses, []int{0, 1, 4}) || m.Register(0) != 2 {
+		t.Error("Got:", addresses, m.Register(0), "Expected:", []int{0, 1, 4}, 2)
+	}
+}
+
 func TestIsValid(t *testing.T) {
 	tests := []struct {
 		value    uint16
@@ -229,8 +250,12 @@ func TestProgramLoad(t *testing.T) {
 		t.Error("Failed to close file", err)
 	}
 
+	c, err := LoadProgram("test.bin")
+	if err != nil {
+		t.Error("Failed to load test file", err)
+	}
 	p := program{}
-	p.load("test.bin")
+	p.loadContainer(c)
 	memoryLen := len(p.memory)
 	expected := 1
 
@@ -379,3 +404,103 @@ func TestStackPush(t *testing.T) {
 		}
 	}
 }
+
+func TestMachineWatchCodes(t *testing.T) {
+	m := NewMachine()
+	for _, c := range "challenge website: aB3dE5gH7jK9\n" {
+		m.Program.memory = append(m.Program.memory, uint16(opOut), uint16(c))
+	}
+
+	c := NewCodeWatcher(nil)
+	m.WatchCodes(c)
+	m.Run()
+
+	if m.Steps() != 32 {
+		t.Error("Got:", m.Steps(), "Expected:", 32)
+	}
+	if len(c.Codes) != 1 || c.Codes[0] != (Code{"aB3dE5gH7jK9", 31, "challenge website: aB3dE5gH7jK9"}) {
+		t.Error("Got:", c.Codes, "Expected:", "aB3dE5gH7jK9 at instruction 31")
+	}
+}
+
+func TestMachineFault(t *testing.T) {
+	m := newTestMachine([]uint16{uint16(opPush), 1, uint16(opPop), register0, uint16(opPop), register1, uint16(opHalt)})
+
+	if stop := m.RunSteps(0); stop != Faulted {
+		t.Fatal("Got:", stop, "Expected:", Faulted)
+	}
+	if m.PC() != 4 {
+		t.Error("Got:", m.PC(), "Expected:", 4)
+	}
+
+	f := m.Fault()
+	if f == nil {
+		t.Fatal("Got:", f, "Expected: a fault")
+	}
+	if f.Address != 4 || f.Instruction.String() != "pop r1" {
+		t.Error("Got:", f.Address, f.Instruction, "Expected:", 4, "pop r1")
+	}
+
+	expected := "fault at 4 (pop r1): pop on an empty stack"
+	if f.Error() != expected {
+		t.Error("Got:", f.Error(), "Expected:", expected)
+	}
+
+	// a stopped machine stays stopped
+	m.Step()
+	if m.Steps() != 2 {
+		t.Error("Got:", m.Steps(), "Expected:", 2)
+	}
+}
+
+func TestMachineStackLimit(t *testing.T) {
+	tests := []struct {
+		src      string
+		limit    int
+		expected StopReason
+	}{
+		{"push 1; push 2; push 3; halt", 0, Halted},
+		{"push 1; push 2; push 3; halt", 3, Halted},
+		{"push 1; push 2; push 3; halt", 2, Faulted},
+		{"f: call f", 100, Faulted},
+	}
+
+	for _, test := range tests {
+		program, err := Assemble(test.src, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := newTestMachine(program)
+		m.SetStackLimit(test.limit)
+
+		result := m.RunSteps(1000)
+		if result != test.expected {
+			t.Error("Got:", result, "Expected:", test.expected, "For:", test.src)
+		}
+		if test.limit > 0 && len(*m.Stack) > test.limit {
+			t.Error("Got:", len(*m.Stack), "Expected at most:", test.limit)
+		}
+	}
+}
+
+func TestMachineWaitingForInput(t *testing.T) {
+	m := NewMachine()
+	m.SetTrace(nil)
+	m.SetOutput(ioutil.Discard)
+	m.LoadContainer(Container{Image: []uint16{uint16(opIn), register0, uint16(opIn), register1, uint16(opHalt)}})
+	m.SetInput(strings.NewReader("ab\n"))
+
+	// waits before reading a line, not while there's some of it left
+	expected := []bool{true, false, false}
+	for i, waiting := range expected {
+		if m.WaitingForInput() != waiting {
+			t.Error("Got:", m.WaitingForInput(), "Expected:", waiting, "At:", i)
+		}
+		m.Step()
+	}
+
+	if i := m.Decode(0); i.Name != "in" || i.Args[0] != register0 {
+		t.Error("Got:", i, "Expected:", "in r0")
+	}
+}